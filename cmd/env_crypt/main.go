@@ -0,0 +1,184 @@
+package main
+
+// 配置加密工具。生成密钥，加解密单个配置值，或加密、解密、更换密钥处理整个TOML配置文件。
+//
+//   env_crypt genkey > etc/config.key
+//   env_crypt -key etc/config.key encrypt 'p@ssw0rd'
+//   env_crypt -key etc/config.key decrypt 'enc:v1:...'
+//   env_crypt -key etc/config.key [-keys Password,Auth] [-w] encrypt-file etc/xxx_svr_prod.toml
+//   env_crypt -key etc/config.key [-w] decrypt-file etc/xxx_svr_prod.toml
+//   env_crypt -key etc/config.key -new-key etc/config.key.new [-w] rotate etc/xxx_svr_prod.toml
+//
+// encrypt-file缺省加密名字像密码、密钥的配置项，可用-keys指定配置项名。
+// 文件按行处理，保留注释和格式，只改写 key = "value" 形式的字符串值。
+// 不指定-key时，按env包的规则从环境变量或${CONFIG_PATH}/config.key读取密钥。
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"../../env"
+)
+
+var (
+	keyFile    = flag.String("key", "", "密钥文件")
+	newKeyFile = flag.String("new-key", "", "rotate使用的新密钥文件")
+	keys       = flag.String("keys", "", "encrypt-file需要加密的配置项名，以逗号分隔")
+	write      = flag.Bool("w", false, "结果写回文件，而不是输出到终端")
+)
+
+// key = "value"  # comment
+var lineRe = regexp.MustCompile(`^(\s*)([A-Za-z0-9_\-]+)(\s*=\s*)("(?:[^"\\]|\\.)*")(.*)$`)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: env_crypt [flags] genkey|encrypt VALUE|decrypt VALUE|encrypt-file FILE|decrypt-file FILE|rotate FILE")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func panicUnless(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func loadKey(filename string) []byte {
+	var key []byte
+	var err error
+	if filename != "" {
+		key, err = env.ReadConfigKeyFile(filename)
+	} else {
+		key, err = env.LoadConfigKey()
+	}
+	panicUnless(err)
+	return key
+}
+
+// 逐行改写配置文件中的字符串值
+func rewriteFile(filename string, fn func(name, value string) (string, error)) {
+	data, err := ioutil.ReadFile(filename)
+	panicUnless(err)
+
+	var out []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	lineNo := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			out = append(out, line)
+			continue
+		}
+		value, err := strconv.Unquote(m[4])
+		if err != nil {
+			out = append(out, line)
+			continue
+		}
+		newValue, err := fn(m[2], value)
+		if err != nil {
+			panicUnless(fmt.Errorf("%s:%d: %s: %v", filename, lineNo, m[2], err))
+		}
+		if newValue != value {
+			line = m[1] + m[2] + m[3] + strconv.Quote(newValue) + m[5]
+		}
+		out = append(out, line)
+	}
+	panicUnless(scanner.Err())
+
+	result := strings.Join(out, "\n") + "\n"
+	if *write {
+		fi, err := os.Stat(filename)
+		panicUnless(err)
+		panicUnless(ioutil.WriteFile(filename, []byte(result), fi.Mode()))
+		return
+	}
+	fmt.Print(result)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+	}
+	cmd := args[0]
+	if cmd != "genkey" && len(args) != 2 {
+		usage()
+	}
+
+	switch cmd {
+	case "genkey":
+		key, err := env.GenerateConfigKey()
+		panicUnless(err)
+		fmt.Println(key)
+
+	case "encrypt":
+		s, err := env.EncryptValue(loadKey(*keyFile), args[1])
+		panicUnless(err)
+		fmt.Println(s)
+
+	case "decrypt":
+		s, err := env.DecryptValue(loadKey(*keyFile), args[1])
+		panicUnless(err)
+		fmt.Println(s)
+
+	case "encrypt-file":
+		key := loadKey(*keyFile)
+		names := make(map[string]bool)
+		for _, name := range strings.Split(*keys, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[strings.ToLower(name)] = true
+			}
+		}
+		rewriteFile(args[1], func(name, value string) (string, error) {
+			if value == "" || env.IsEncrypted(value) {
+				return value, nil
+			}
+			if len(names) > 0 && !names[strings.ToLower(name)] {
+				return value, nil
+			}
+			if len(names) == 0 && !env.IsSecretName(name) {
+				return value, nil
+			}
+			return env.EncryptValue(key, value)
+		})
+
+	case "decrypt-file":
+		key := loadKey(*keyFile)
+		rewriteFile(args[1], func(name, value string) (string, error) {
+			if !env.IsEncrypted(value) {
+				return value, nil
+			}
+			return env.DecryptValue(key, value)
+		})
+
+	case "rotate":
+		if *newKeyFile == "" {
+			usage()
+		}
+		key := loadKey(*keyFile)
+		newKey := loadKey(*newKeyFile)
+		rewriteFile(args[1], func(name, value string) (string, error) {
+			if !env.IsEncrypted(value) {
+				return value, nil
+			}
+			plain, err := env.DecryptValue(key, value)
+			if err != nil {
+				return "", err
+			}
+			return env.EncryptValue(newKey, plain)
+		})
+
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+// 配置注册中心服务。
+//
+//   GET  ApiBase/registry/list?server=xxx_svr
+//   GET  ApiBase/registry/get?server=xxx_svr&config=prod[&section=http]
+//   POST ApiBase/registry/create  {"server":"xxx_svr","config":"prod","sections":{"http":{"Bind":":8787"}}}
+//   POST ApiBase/registry/update  {"server":"xxx_svr","config":"prod","section":"http","data":{"Bind":":8788"},"comment":"..."}
+//   POST ApiBase/registry/update  {"server":"xxx_svr","config":"prod","section":"http","delete":true,"comment":"..."}
+//   GET  ApiBase/registry/watch?server=xxx_svr&config=prod&version=3[&timeout=30]
+//   GET  ApiBase/registry/revisions?server=xxx_svr&config=prod[&version=2]
+//   GET  ApiBase/registry/diff?server=xxx_svr&config=prod&from=2[&to=3]
+//   POST ApiBase/registry/rollback  {"server":"xxx_svr","config":"prod","version":2,"comment":"..."}
+//
+// 除list外都需要鉴权。get、watch供服务调用，校验apisign签名：客户端(env)以-registry-app
+// 和环境变量ENVREG_REGISTRY_SECRET签名请求，app和secret需登记在ext的app表中。
+// 其余接口供管理使用，校验用户登录。
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"../../env"
+	"../../httputil"
+	"../../registry"
+)
+
+var (
+	logger = env.NewLogger("main")
+
+	_VERSION_ = "Unknown"
+)
+
+func panicUnless(err error) {
+	if err != nil {
+		logger.Fatal(err.Error())
+		os.Exit(2)
+	}
+}
+
+func main() {
+	var version = flag.Bool("v", false, "")
+	flag.Parse()
+	if *version {
+		fmt.Println("Version [", _VERSION_, "]")
+		return
+	}
+	fmt.Println("Starting env_registry...")
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	env.InitEnv("env_registry")
+
+	httputil.HandleAPIMap("/registry", registry.APIMap)
+	panicUnless(httputil.Listen(false))
+}
@@ -4,9 +4,9 @@ package env
 
 import (
 	"expvar"
+	"flag"
 	"fmt"
 	std_log "log"
-	"sync"
 	// log "github.com/cihub/seelog"
 	"github.com/echou/toml"
 	"net"
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"../log"
 )
 
 // 配置结构体注册
@@ -32,20 +33,28 @@ func (f InitFunc) Init() error {
 }
 
 type LogConfig struct {
-	LogFilePath string `desc: "日志路径"`		
-	DebugOpen   bool   `desc: "开启DEBUG模式（输出日志到终端）`
+	LogFilePath string `desc:"日志路径"`		
+	DebugOpen   bool   `desc:"开启DEBUG模式（输出日志到终端）"`
 }
 
 func (config *LogConfig) Init() error {
 	log.Init(logConfig.LogFilePath, logConfig.DebugOpen)	
 	return nil
 }
+
+func (config *LogConfig) Reload() error { //日志路径与DEBUG开关可在线生效
+	if log.Config.FilePath == config.LogFilePath && log.Config.Debug == config.DebugOpen {
+		return nil //未变化时继续使用已打开的日志文件
+	}
+	log.Init(config.LogFilePath, config.DebugOpen)
+	return nil
+}
+
+func (config *LogConfig) Close() error { //最先初始化，最后关闭
+	return log.Close()
+}
 	
 var (
-	tomlConfigMaps = make(map[string]interface{})
-	initializers   []Initializer
-
-	once sync.Once
 	logConfig = &LogConfig{
 		LogFilePath: "/tmp/tusk.log",	
 		DebugOpen:   false,
@@ -71,21 +80,51 @@ var (
       Foo: "a",
       Bar: []int{1,2,3}
   }
+  缺省值也可以用default标签指定，此时可直接注册&FooConfig{}，见envdefault.go
 4. 在init函数中向env注册该配置变量。注册名就是配置文件中的section名
   func init() {
       env.Register("foo", fooConfig)
   }
+5. 初始化方法依赖其他section时，声明依赖的section名（可选）。依赖的section不必实现Initializer
+  env.Register("foo", fooConfig, env.DependsOn("log"))
+6. 退出时需要释放资源的，实现Stopper或Closer接口（可选），按初始化的相反顺序调用
+  func (this *FooConfig) Stop(ctx context.Context) error {
+      ...
+  }
 
 */
-func Register(sectionName string, config interface{}) {  //注册一般interface
-	tomlConfigMaps[sectionName] = config
-	if initializer, ok := config.(Initializer); ok {  //若实现Initializer,则追加
-		initializers = append(initializers, initializer)
+func Register(sectionName string, config interface{}, opts ...InitOption) {  //注册一般interface
+	defaultEnv.Register(sectionName, config, opts...)
+}
+
+func (e *Env) Register(sectionName string, config interface{}, opts ...InitOption) {
+	if err := applyDefaultTags(reflect.ValueOf(config), sectionName); err != nil { //default标签设置缺省值
+		panic("env: register " + sectionName + "|" + err.Error())
+	}
+	e.tomlConfigMaps[sectionName] = config
+	e.saveDefault(sectionName, config)
+	if e.isDefault {
+		defineFieldFlags(sectionName, config)
+	}
+	if initializer, ok := config.(Initializer); ok {  //若实现Initializer,则以section名追加
+		e.RegisterInitializerNamed(sectionName, initializer, opts...)
+	} else { //未实现Initializer的也以section名追加空的初始化方法，供其他section依赖
+		e.RegisterInitializerNamed(sectionName, InitFunc(func() error { return nil }), opts...)
+		if stopper := stopperOf(config); stopper != nil { //未实现Initializer的Stopper/Closer最后停止
+			e.RegisterStopper(sectionName, stopper)
+		}
+	}
+	if reloadable, ok := config.(Reloadable); ok { //若实现Reloadable,则追加
+		e.reloadables = append(e.reloadables, reloadable)
 	}
 }
 
 func RegisterInitializer(initializer Initializer) { //注册实现了Initializer的interface
-	initializers = append(initializers, initializer)
+	defaultEnv.RegisterInitializer(initializer)
+}
+
+func (e *Env) RegisterInitializer(initializer Initializer) {
+	e.initializers = append(e.initializers, &namedInitializer{initializer: initializer})
 }
 
 func RegisterInitFunc(fun InitFunc) {  //注册实现Initializer的func
@@ -94,7 +133,14 @@ func RegisterInitFunc(fun InitFunc) {  //注册实现Initializer的func
 
 // 替换字符串中出现的${..}路径变量。
 func PathReplace(s string) string {
-	return PathReplacer.Replace(s)
+	return defaultEnv.PathReplace(s)
+}
+
+func (e *Env) PathReplace(s string) string {
+	if e.PathReplacer == nil { //尚未初始化路径变量
+		return s
+	}
+	return e.PathReplacer.Replace(s)
 }
 
 var ( // 配置参数
@@ -155,41 +201,69 @@ func indirect(v reflect.Value) reflect.Value {
 	return indirect(reflect.Indirect(v))
 }
 
-// 显示当前所有配置项
-func Help(serverName, configName string) {  //svr类型、dev/prod类型
-
+// 程序运行目录的上级目录，可用-base-path指定
+func defaultBasePath() string {
+	if flagBasePath != "" {
+		return path.Clean(flagBasePath)
+	}
 	fullPath, _ := filepath.Abs(os.Args[0]) //获取程序运行绝对路径
-	curDir := path.Dir(fullPath)
-	// 检查当前目录或上级目录是否有etc子目录
-	BasePath = path.Clean(path.Join(curDir, "..")) //获取程序运行上级目录
-
-	Eth0IP = getInterfaceIPv4Addr("eth0", "en0")
-	Eth1IP = getInterfaceIPv4Addr("eth1", "en1")
-	LocalIP = Eth1IP
-
-	PathReplacer = strings.NewReplacer( //生成替换器
-		"${BASE_PATH}", BasePath, //[old, new]...
-		"${CONFIG_PATH}", path.Join(BasePath, PATH_ETC),
-		"${LOG_PATH}", path.Join(BasePath, PATH_LOGS),
-		"${VAR_PATH}", path.Join(BasePath, PATH_VAR),
+	return path.Clean(path.Join(path.Dir(fullPath), ".."))
+}
+
+// 配置文件目录，可用-config-dir指定
+func ConfigPath() string {
+	return defaultEnv.ConfigPath()
+}
+
+func (e *Env) ConfigPath() string {
+	if e.ConfigDir != "" {
+		return e.ConfigDir
+	}
+	if e.isDefault && flagConfigDir != "" {
+		return flagConfigDir
+	}
+	return path.Join(e.BasePath, PATH_ETC)
+}
+
+// 生成路径变量替换器。缺省实例同时获取本机地址
+func (e *Env) initPathReplacer(serverName, configName string) {
+	if e.isDefault {
+		Eth0IP = getInterfaceIPv4Addr("eth0", "en0")
+		Eth1IP = getInterfaceIPv4Addr("eth1", "en1")
+		discoverLocalAddrs()
+	}
+
+	e.setPathVars( //生成替换器
+		"${BASE_PATH}", e.BasePath, //[old, new]...
+		"${CONFIG_PATH}", e.ConfigPath(),
+		"${LOG_PATH}", path.Join(e.BasePath, PATH_LOGS),
+		"${VAR_PATH}", path.Join(e.BasePath, PATH_VAR),
 		// ip地址
 		"${ETH0_IP}", Eth0IP,
 		"${ETH1_IP}", Eth1IP,
-		"${LOCAL_IP}", Eth1IP,
+		"${LOCAL_IP}", LocalIP,
+		"${LOCAL_IPV6}", LocalIPv6,
+		"${HOSTNAME}", HostName,
+		"${OUTBOUND_IP}", OutboundIP,
 		"${SERVER_NAME}", serverName,
 		"${CONFIG_NAME}", configName,
 	)
+}
+
+// 显示当前所有配置项
+func Help(serverName, configName string) {  //svr类型、dev/prod类型
+	e := defaultEnv
+	e.setBasePath(defaultBasePath()) //获取程序运行上级目录
+	e.initPathReplacer(serverName, configName)
 
 	// 载入配置
-	configFilename := fmt.Sprintf("%s_%s.toml", serverName, configName) //拼凑配置文件全名
-	configRealPath := path.Join(BasePath, PATH_ETC, configFilename)
-	_, err := toml.DecodeFile(configRealPath, tomlConfigMaps) //解析配置文件内容到配置变量
+	err := e.loadConfig(e.configLoaderFor(serverName, configName)) //解析各层配置到配置变量
 	if err != nil {
 		fmt.Println("Config file syntax error!", err)
 		return
 	}
 
-	for key, obj := range tomlConfigMaps {
+	for key, obj := range e.tomlConfigMaps {
 		v := indirect(reflect.ValueOf(obj))
 		rt := v.Type()
 		fmt.Printf("\n%-20s (定义于%s)\n\n", "["+key+"]", rt.PkgPath()) //打印配置变量定义包名
@@ -199,23 +273,39 @@ func Help(serverName, configName string) {  //svr类型、dev/prod类型
 			if desc == "" {
 				desc = "<无描述>"
 			}
-			val := v.Field(i).Interface() //Value.Field仅用于结构体
-			var real_val interface{}
-			switch val0 := val.(type) {
-			case string:
-				real_val = PathReplace(val0) //替换配置文件中指定字符串
-			default:
-				real_val = val0
+			real_val := maskValue(v.Field(i)) //嵌套结构体、map中的敏感配置项同样脱敏
+			if s, ok := real_val.(string); ok {
+				real_val = e.PathReplace(s) //替换配置文件中指定字符串
+			}
+			var def_val interface{} //注册时的缺省值，含default标签
+			if d, ok := e.configDefaults[key]; ok {
+				def_val = maskValue(d.Field(i))
+			}
+			if isSecretField(f) { //敏感配置项脱敏
+				real_val = maskSecret(real_val)
+				def_val = maskSecret(def_val)
 			}
 
-			fmt.Printf("    %-20s %-15s %s: \"%v\"\n", f.Name, f.Type, desc, real_val)
+			source := " <- " + lookupSource(e.fieldSources, key+"."+tomlName(f)) //配置项来源
+
+			fmt.Printf("    %-20s %-15s %s: \"%v\" (缺省: \"%v\")%s\n", f.Name, f.Type, desc, real_val, def_val, source)
 		}
 	}
+	fmt.Println("配置来源:", strings.Join(e.configSources, ", "))
 	fmt.Println()
 
 }
 
-func envConfig() interface{} { return tomlConfigMaps }
+func envConfig() interface{} {
+	e := defaultEnv
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	return map[string]interface{}{
+		"config":  e.maskedSections(),
+		"files":   e.configSources,
+		"sources": e.fieldSources,
+	}
+}
 
 func init() {
 	// Register("seelog", seelogConfig)
@@ -225,7 +315,8 @@ func init() {
 }
 
 func InitEnvForUT(config string) {
-	PathReplacer = strings.NewReplacer(
+	e := defaultEnv
+	e.setPathVars(
 		"${BASE_PATH}", "/tmp",
 		"${CONFIG_PATH}", "/etc",
 		"${LOG_PATH}", "/tmp/log",
@@ -234,124 +325,174 @@ func InitEnvForUT(config string) {
 		"${ETH0_IP}", "127.0.0.1",
 		"${ETH1_IP}", "127.0.0.1",
 		"${LOCAL_IP}", "127.0.0.1",
+		"${LOCAL_IPV6}", "::1",
+		"${HOSTNAME}", "localhost",
+		"${OUTBOUND_IP}", "127.0.0.1",
 		"${SERVER_NAME}", "test",
 		"${CONFIG_NAME}", "",
 	)
 
-	_, err := toml.Decode(config, tomlConfigMaps)
+	_, err := toml.Decode(config, e.tomlConfigMaps)
+	if err != nil {
+		panic(err)
+	}
+	err = e.resolveSections(e.tomlConfigMaps)
 	if err != nil {
 		panic(err)
 	}
+	if e.expandVars() {
+		e.expandSections(e.tomlConfigMaps)
+	}
 
 	// Initializers
-	for _, initializer := range initializers {
-		err = initializer.Init()
-		if err != nil {
-			panic(err)
-		}
+	err = e.runInitializers()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// 载入并校验配置，不调用Initializer。用于-check-config，未知配置项也视为错误
+func CheckConfig(serverName, configName string) error {
+	StrictConfig = true
+	e := defaultEnv
+	e.setBasePath(defaultBasePath())
+	e.initPathReplacer(serverName, configName)
+	err := e.loadConfig(e.configLoaderFor(serverName, configName))
+	if err != nil {
+		return err
 	}
+	_, err = e.InitOrder()
+	return err
 }
 
+// 初始化运行环境。解析命令行参数，载入配置并调用所有Initializer
 func InitEnv(serverName string) {
-	configName := "config"
-	if len(os.Args) > 1 {
-		configName = os.Args[1]
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	configName, err := flagConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	if configName == "config" {
-		configName = "dev"
-		if len(os.Args) > 2 {
-			configName = os.Args[2]
-			Help(serverName, configName)  //实际调用注册环境
-			os.Exit(0)
+	if flagPrintConfig {
+		Help(serverName, configName) //实际调用注册环境
+		os.Exit(0)
+	}
+	if flagGenConfig {
+		e := defaultEnv
+		e.setBasePath(defaultBasePath())
+		e.initPathReplacer(serverName, configName)
+		if err := e.loadConfig(e.configLoaderFor(serverName, configName)); err != nil { //未能载入时当前值即缺省值
+			fmt.Fprintln(os.Stderr, "Config not loaded, current values are defaults:", err)
+		}
+		err := GenConfig(os.Stdout, flagGenFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if flagDiffConfig != "" {
+		diffs, err := DiffConfig(serverName, configName, flagDiffConfig)
+		if err == nil {
+			err = WriteConfigDiff(os.Stdout, configName, flagDiffConfig, diffs, flagDiffFormat)
 		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if flagCheckConfig {
+		err := CheckConfig(serverName, configName)
+		if err != nil {
+			fmt.Println("Config check failed!", err)
+			os.Exit(1)
+		}
+		fmt.Println("Config OK:", strings.Join(defaultEnv.configSources, ", "))
+		os.Exit(0)
 	}
 
-	once.Do(func() {
-		fullPath, _ := filepath.Abs(os.Args[0])
-		BasePath = path.Clean(path.Join(path.Dir(fullPath), ".."))
-		std_log.Println("BasePath is ", BasePath)
+	e := defaultEnv
+	e.once.Do(func() {
+		e.setBasePath(defaultBasePath())
+		std_log.Println("BasePath is ", e.BasePath)
 		std_log.Println("Server name is ", serverName)
 		std_log.Println("Config name is ", configName)
+		std_log.Println("Config path is ", e.ConfigPath())
+		if RegistryURL != "" {
+			std_log.Println("Registry is ", RegistryURL)
+		}
 
-		Eth0IP = getInterfaceIPv4Addr("eth0", "en0")
-		Eth1IP = getInterfaceIPv4Addr("eth1", "en1")
-
-		PathReplacer = strings.NewReplacer(
-			"${BASE_PATH}", BasePath,
-			"${CONFIG_PATH}", path.Join(BasePath, PATH_ETC),
-			"${LOG_PATH}", path.Join(BasePath, PATH_LOGS),
-			"${VAR_PATH}", path.Join(BasePath, PATH_VAR),
-			// ip地址
-			"${ETH0_IP}", Eth0IP,
-			"${ETH1_IP}", Eth1IP,
-			"${LOCAL_IP}", Eth1IP,
-			"${SERVER_NAME}", serverName,
-			"${CONFIG_NAME}", configName,
-		)
+		e.initPathReplacer(serverName, configName)
+		std_log.Println("Local IP is ", LocalIP)
 
 		// 载入配置
-		configFilename := fmt.Sprintf("%s_%s.toml", serverName, configName)
-		configRealPath := path.Join(BasePath, PATH_ETC, configFilename)
-		_, err := toml.DecodeFile(configRealPath, tomlConfigMaps)
+		err := e.loadConfig(e.configLoaderFor(serverName, configName))
 		if err != nil {
 			panic(err)
 		}
 
-		std_log.Println("Config file is ", configRealPath)
-		std_log.Println("Log Path is ", path.Join(BasePath, PATH_LOGS))
+		std_log.Println("Config sources are ", e.configSources)
+		std_log.Println("Log Path is ", path.Join(e.BasePath, PATH_LOGS))
 
 		// Initializers
-		for _, initializer := range initializers {
-			err = initializer.Init()
-			if err != nil {
-				panic(err)
-			}
+		order, err := e.InitOrder()
+		if err != nil {
+			panic(err)
+		}
+		std_log.Println("Init order is ", strings.Join(order, ", "))
+		err = e.runInitializers()
+		if err != nil {
+			panic(err)
+		}
+
+		// 监视配置文件变化
+		if ReloadInterval > 0 && len(e.configFiles) > 0 {
+			go e.watchConfig(ReloadInterval)
+		}
+		if RegistryURL != "" {
+			e.startRegistryWatch(RegistryURL, serverName, configName)
+		}
+
+		// 收到SIGTERM/SIGINT时按相反顺序停止组件
+		if HandleSignals {
+			go e.handleSignals()
 		}
 	})
 }
 
 func InitEnv4Test(basePath, serverName, configName string) { //for test
-	BasePath = basePath
-	once.Do(func() {
+	e := defaultEnv
+	e.setBasePath(basePath)
+	e.once.Do(func() {
 		//fullPath, _ := filepath.Abs(os.Args[0])
 		//BasePath = path.Clean(path.Join(path.Dir(fullPath), ".."))
-		std_log.Println("BasePath is ", BasePath)
+		std_log.Println("BasePath is ", e.BasePath)
 		std_log.Println("Server name is ", serverName)
 		std_log.Println("Config name is ", configName)
 
-		Eth0IP = getInterfaceIPv4Addr("eth0", "en0")
-		Eth1IP = getInterfaceIPv4Addr("eth1", "en1")
-
-		PathReplacer = strings.NewReplacer(
-			"${BASE_PATH}", BasePath,
-			"${CONFIG_PATH}", path.Join(BasePath, PATH_ETC),
-			"${LOG_PATH}", path.Join(BasePath, PATH_LOGS),
-			"${VAR_PATH}", path.Join(BasePath, PATH_VAR),
-			// ip地址
-			"${ETH0_IP}", Eth0IP,
-			"${ETH1_IP}", Eth1IP,
-			"${LOCAL_IP}", Eth1IP,
-			"${SERVER_NAME}", serverName,
-			"${CONFIG_NAME}", configName,
-		)
+		e.initPathReplacer(serverName, configName)
 
 		// 载入配置
-		configFilename := fmt.Sprintf("%s_%s.toml", serverName, configName)
-		configRealPath := path.Join(BasePath, PATH_ETC, configFilename)
-		_, err := toml.DecodeFile(configRealPath, tomlConfigMaps)
+		err := e.loadConfig(e.configLoaderFor(serverName, configName))
 		if err != nil {
 			panic(err)
 		}
 
-		std_log.Println("Config file is ", configRealPath)
+		std_log.Println("Config sources are ", e.configSources)
 
 		// Initializers
-		for _, initializer := range initializers {
-			err = initializer.Init()
-			if err != nil {
-				panic(err)
-			}
+		order, err := e.InitOrder()
+		if err != nil {
+			panic(err)
+		}
+		std_log.Println("Init order is ", strings.Join(order, ", "))
+		err = e.runInitializers()
+		if err != nil {
+			panic(err)
 		}
 	})
 }
@@ -0,0 +1,204 @@
+package env
+
+// 本机地址发现。${LOCAL_IP}等变量在载入配置前确定，因此发现规则由命令行参数或环境变量指定：
+//   -local-ifaces "eth1,en1,eth0,en0,!veth*,!docker*,*"   网卡名匹配规则，按顺序优先，!开头的排除
+//   -local-cidrs  "10.0.0.0/8,172.16.0.0/12"               优先选择的网段，按顺序优先
+//   -local-ipv6                                           ${LOCAL_IP}优先使用IPv6地址
+//   -local-target "10.0.0.1:53"                           ${OUTBOUND_IP}为访问该地址时使用的本机地址
+// 对应的环境变量为 ENVREG_LOCAL_IFACES、ENVREG_LOCAL_CIDRS、ENVREG_LOCAL_IPV6、ENVREG_LOCAL_TARGET。
+// 提供以下路径变量：
+//   ${LOCAL_IP}     首选本机地址
+//   ${LOCAL_IPV6}   首选本机IPv6地址（不含链路本地地址）
+//   ${HOSTNAME}     主机名
+//   ${OUTBOUND_IP}  访问-local-target时使用的本机地址
+// 程序中可用LocalAddrs()取得按优先顺序排列的所有本机地址。
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	LocalIfaces = "eth1,en1,eth0,en0,!veth*,!docker*,*" // 网卡名匹配规则
+	LocalCIDRs  string                                  // 优先选择的网段
+	PreferIPv6  bool                                    // ${LOCAL_IP}优先使用IPv6地址
+	LocalTarget string                                  // 用于确定${OUTBOUND_IP}的目标地址
+
+	LocalIPv6  string // 首选本机IPv6地址
+	HostName   string // 主机名
+	OutboundIP string // 访问LocalTarget时使用的本机地址
+)
+
+func init() {
+	if s := os.Getenv("ENVREG_LOCAL_IFACES"); s != "" {
+		LocalIfaces = s
+	}
+	flag.StringVar(&LocalIfaces, "local-ifaces", LocalIfaces, "本机地址的网卡名匹配规则，以逗号分隔，!开头的排除")
+	flag.StringVar(&LocalCIDRs, "local-cidrs", os.Getenv("ENVREG_LOCAL_CIDRS"), "优先选择的本机地址网段，以逗号分隔")
+	flag.BoolVar(&PreferIPv6, "local-ipv6", os.Getenv("ENVREG_LOCAL_IPV6") != "", "${LOCAL_IP}优先使用IPv6地址")
+	flag.StringVar(&LocalTarget, "local-target", os.Getenv("ENVREG_LOCAL_TARGET"), "${OUTBOUND_IP}为访问该地址时使用的本机地址")
+}
+
+// 一个本机地址
+type LocalAddr struct {
+	Interface string `json:"interface"`
+	IP        net.IP `json:"ip"`
+}
+
+func (a LocalAddr) IsIPv4() bool {
+	return a.IP.To4() != nil
+}
+
+// 网卡名的优先顺序，排除或不匹配时返回-1
+func ifaceRank(name string, patterns []string) int {
+	for i, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), name); !ok {
+			continue
+		}
+		if exclude {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+// 地址所在网段的优先顺序，不在优先网段中时返回len(cidrs)
+func cidrRank(ip net.IP, cidrs []*net.IPNet) int {
+	for i, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return i
+		}
+	}
+	return len(cidrs)
+}
+
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, item := range splitList(s) {
+		_, cidr, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 返回按优先顺序排列的本机地址，不含回环地址和IPv6链路本地地址。
+// 先按-local-cidrs网段，再按-local-ifaces网卡名规则排序
+func LocalAddrs() ([]LocalAddr, error) {
+	cidrs, err := parseCIDRs(LocalCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("local addrs|bad cidr|%v", err)
+	}
+	patterns := splitList(LocalIfaces)
+	intfs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	type rankedAddr struct {
+		LocalAddr
+		cidr, iface, index int
+	}
+	var ranked []rankedAddr
+	for _, intf := range intfs {
+		if intf.Flags&net.FlagUp == 0 || intf.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		rank := ifaceRank(intf.Name, patterns)
+		if rank < 0 {
+			continue
+		}
+		addrs, _ := intf.Addrs()
+		for _, addr := range addrs {
+			ip, _, err := net.ParseCIDR(addr.String())
+			if err != nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			ranked = append(ranked, rankedAddr{LocalAddr{intf.Name, ip}, cidrRank(ip, cidrs), rank, len(ranked)})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.cidr != b.cidr {
+			return a.cidr < b.cidr
+		}
+		if a.iface != b.iface {
+			return a.iface < b.iface
+		}
+		return a.index < b.index
+	})
+	ret := make([]LocalAddr, len(ranked))
+	for i, a := range ranked {
+		ret[i] = a.LocalAddr
+	}
+	return ret, nil
+}
+
+// 返回访问target时使用的本机地址。使用UDP确定路由，不发送数据
+func OutboundAddr(target string) (net.IP, error) {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// 发现本机地址，设置LocalIP、LocalIPv6、HostName、OutboundIP
+func discoverLocalAddrs() {
+	LocalIP, LocalIPv6 = "", ""
+	addrs, err := LocalAddrs()
+	if err != nil {
+		logEnv.Errorf("local addrs|%v", err)
+	}
+	var ipv4 string
+	for _, addr := range addrs {
+		if addr.IsIPv4() && ipv4 == "" {
+			ipv4 = addr.IP.String()
+		}
+		if !addr.IsIPv4() && LocalIPv6 == "" {
+			LocalIPv6 = addr.IP.String()
+		}
+	}
+	LocalIP = ipv4
+	if LocalIP == "" || PreferIPv6 && LocalIPv6 != "" {
+		LocalIP = LocalIPv6
+	}
+
+	HostName, err = os.Hostname()
+	if err != nil {
+		logEnv.Errorf("hostname|%v", err)
+	}
+
+	OutboundIP = ""
+	if LocalTarget != "" {
+		ip, err := OutboundAddr(LocalTarget)
+		if err != nil {
+			logEnv.Errorf("outbound addr|%s|%v", LocalTarget, err)
+		} else {
+			OutboundIP = ip.String()
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package env
+
+// 加密配置项。配置文件中形如 "enc:v1:BASE64..." 的字符串在解析后自动以AES-GCM解密，
+// 密文为base64(nonce + ciphertext)。密钥为base64编码的16/24/32字节，按以下顺序读取：
+//   1. 环境变量 ENVREG_CONFIG_KEY
+//   2. 环境变量 ENVREG_CONFIG_KEY_FILE 指定的密钥文件
+//   3. ${CONFIG_PATH}/config.key
+// 环境变量、命令行参数覆盖的值及${file:...}读到的值也可以是加密值。
+// 配置中没有加密值时不读取密钥。加解密及更换密钥使用 cmd/env_crypt 工具。
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+)
+
+const ENC_PREFIX = "enc:v1:" // 加密配置项前缀
+
+var (
+	ConfigKeyEnv     = "ENVREG_CONFIG_KEY"      // 密钥环境变量
+	ConfigKeyFileEnv = "ENVREG_CONFIG_KEY_FILE" // 密钥文件路径环境变量
+	ConfigKeyFile    = "config.key"             // 缺省密钥文件，位于${CONFIG_PATH}
+)
+
+// 是否为加密配置项
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, ENC_PREFIX)
+}
+
+// 生成一个新的AES-256密钥，返回base64编码
+func GenerateConfigKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func parseConfigKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("config key|bad base64|%v", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("config key|bad length %d", len(key))
+}
+
+// 读取密钥文件
+func ReadConfigKeyFile(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigKey(string(data))
+}
+
+// 按环境变量、密钥文件的顺序读取解密配置用的密钥
+func LoadConfigKey() ([]byte, error) {
+	return defaultEnv.LoadConfigKey()
+}
+
+// 缺省密钥文件位于本实例的配置文件目录
+func (e *Env) LoadConfigKey() ([]byte, error) {
+	if s := os.Getenv(ConfigKeyEnv); s != "" {
+		return parseConfigKey(s)
+	}
+	filename := os.Getenv(ConfigKeyFileEnv)
+	if filename == "" {
+		filename = path.Join(e.ConfigPath(), ConfigKeyFile)
+	}
+	return ReadConfigKeyFile(filename)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 加密一个配置值，返回带enc:v1:前缀的密文
+func EncryptValue(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return ENC_PREFIX + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// 解密一个带enc:v1:前缀的配置值
+func DecryptValue(key []byte, s string) (string, error) {
+	if !IsEncrypted(s) {
+		return "", fmt.Errorf("decrypt|not an encrypted value")
+	}
+	data, err := base64.StdEncoding.DecodeString(s[len(ENC_PREFIX):])
+	if err != nil {
+		return "", fmt.Errorf("decrypt|bad base64|%v", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("decrypt|data too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt|%v", err)
+	}
+	return string(plain), nil
+}
+
+// 解密配置中所有加密的字符串，密钥在遇到第一个加密值时读取
+type rawDecrypter struct {
+	env     *Env
+	key     []byte
+	lenient bool // 无法解密时保持原样
+}
+
+func (d *rawDecrypter) decryptMap(m map[string]interface{}, keyPath string) error {
+	for k, v := range m {
+		v0, err := d.decryptValue(v, joinKey(keyPath, k))
+		if err != nil {
+			return err
+		}
+		m[k] = v0
+	}
+	return nil
+}
+
+func (d *rawDecrypter) decryptValue(v interface{}, keyPath string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return val, d.decryptMap(val, keyPath)
+	case []interface{}:
+		for i, v0 := range val {
+			v1, err := d.decryptValue(v0, fmt.Sprintf("%s[%d]", keyPath, i))
+			if err != nil {
+				return nil, err
+			}
+			val[i] = v1
+		}
+		return val, nil
+	case string:
+		plain, err := d.decryptString(keyPath, val)
+		if err != nil {
+			return nil, err
+		}
+		return plain, nil
+	}
+	return v, nil
+}
+
+func (d *rawDecrypter) decryptString(keyPath, s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	if d.key == nil {
+		key, err := d.env.LoadConfigKey()
+		if err != nil {
+			if d.lenient {
+				return s, nil
+			}
+			return "", fmt.Errorf("%s: load config key|%v", keyPath, err)
+		}
+		d.key = key
+	}
+	plain, err := DecryptValue(d.key, s)
+	if err != nil {
+		if d.lenient {
+			return s, nil
+		}
+		return "", fmt.Errorf("%s: %v", keyPath, err)
+	}
+	return plain, nil
+}
+
+// 解密覆盖和占位符解析后得到的加密值，如环境变量、命令行参数或${file:...}中的enc:v1:值。
+// 配置文件中的加密值已在合并时解密
+func (e *Env) decryptSections(sections map[string]interface{}) error {
+	d := &rawDecrypter{env: e}
+	for _, name := range sortedKeys(sections) {
+		err := walkStrings(reflect.ValueOf(sections[name]), name, d.decryptString)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
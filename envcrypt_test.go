@@ -0,0 +1,48 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// 环境变量覆盖和${file:...}得到的加密值同样解密
+func TestDecryptOverrides(t *testing.T) {
+	if os.Getenv(ConfigKeyEnv) != "" || os.Getenv(ConfigKeyFileEnv) != "" {
+		t.Skip("config key set in environment")
+	}
+	secret := path.Join(os.TempDir(), "envcrypt_secret")
+	dir := writeInstanceConfig(t, "host", "password", "")
+	defer os.RemoveAll(dir)
+
+	encoded, err := ioutil.ReadFile(path.Join(dir, ConfigKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parseConfigKey(string(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := EncryptValue(key, "env-host")
+	dataDir, _ := EncryptValue(key, "/data/secret")
+	if err := ioutil.WriteFile(secret, []byte(dataDir+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+	os.Setenv("TESTC_DB_HOST", host)
+	defer os.Unsetenv("TESTC_DB_HOST")
+	os.Setenv("TESTC_DB_DATADIR", "${file:"+secret+"}")
+	defer os.Unsetenv("TESTC_DB_DATADIR")
+
+	e, db := New(), &instanceTestConfig{}
+	e.ConfigDir = dir
+	e.EnvPrefix = "TESTC_"
+	e.Register("db", db)
+	if err := e.Init("svr", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if *db != (instanceTestConfig{"env-host", "password", "/data/secret"}) {
+		t.Errorf("db: %+v", db)
+	}
+}
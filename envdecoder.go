@@ -0,0 +1,173 @@
+package env
+
+// 配置文件解码器。按扩展名选择解码器，将配置文件解析为 section名 -> 配置项 的通用map，
+// 再统一转换为TOML注入已注册的配置变量，因此各种格式使用相同的section名和字段名。
+//
+// 缺省支持 .toml、.yaml、.yml、.json，查找 <server>_<config>.<ext> 时按此顺序，
+// 先找到的文件生效。
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/echou/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// 配置文件解码器接口
+type Decoder interface {
+	Decode(data []byte) (map[string]interface{}, error)
+}
+
+// 解码函数，实现了Decoder接口
+type DecoderFunc func(data []byte) (map[string]interface{}, error)
+
+func (f DecoderFunc) Decode(data []byte) (map[string]interface{}, error) {
+	return f(data)
+}
+
+var (
+	decoders    = make(map[string]Decoder) // 扩展名 -> 解码器
+	decoderExts []string                   // 查找配置文件时的扩展名顺序
+)
+
+// 注册一个配置文件解码器。ext为带"."的扩展名，如".yaml"。
+// 重复注册同一扩展名时替换原有解码器，查找顺序不变。
+func RegisterDecoder(ext string, decoder Decoder) {
+	ext = strings.ToLower(ext)
+	if _, ok := decoders[ext]; !ok {
+		decoderExts = append(decoderExts, ext)
+	}
+	decoders[ext] = decoder
+}
+
+func RegisterDecoderFunc(ext string, fun DecoderFunc) {
+	RegisterDecoder(ext, fun)
+}
+
+func init() {
+	RegisterDecoderFunc(".toml", decodeTOML)
+	RegisterDecoderFunc(".yaml", decodeYAML)
+	RegisterDecoderFunc(".yml", decodeYAML)
+	RegisterDecoderFunc(".json", decodeJSON)
+}
+
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	raw := make(map[string]interface{})
+	_, err := toml.Decode(string(data), &raw)
+	return raw, err
+}
+
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	raw := make(map[string]interface{})
+	err := yaml.Unmarshal(data, &raw)
+	return raw, err
+}
+
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	raw := make(map[string]interface{})
+	err := json.Unmarshal(data, &raw)
+	return raw, err
+}
+
+// 在dir中查找 <serverName>_<configName>.<ext> 配置文件。
+// 都不存在时返回.toml文件名，由后续读取时报错
+func findConfigFile(dir, serverName, configName string) string {
+	base := path.Join(dir, fmt.Sprintf("%s_%s", serverName, configName))
+	for _, ext := range decoderExts {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + ".toml"
+}
+
+// 按扩展名读取并解析配置文件为通用map
+func readRawConfig(filename string) (map[string]interface{}, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	decoder, ok := decoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("no decoder for config file %s", filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decoder.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return normalizeMap(raw), nil
+}
+
+// 将通用map注入配置变量。先编码为TOML，再以TOML规则解码，
+// 保证各种格式的字段匹配、类型转换与TOML配置文件一致
+func decodeRawSections(raw map[string]interface{}, sections map[string]interface{}) (toml.MetaData, error) {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(raw)
+	if err != nil {
+		return toml.MetaData{}, err
+	}
+	return toml.Decode(buf.String(), sections)
+}
+
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if v = normalizeValue(v); v != nil {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// 将各解码器的结果统一为TOML可编码的类型：
+// map的key转为字符串，整数统一为int64，整数值的浮点数(JSON)转为int64，去掉null
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return normalizeMap(val)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, v0 := range val {
+			m[fmt.Sprint(k)] = v0
+		}
+		return normalizeMap(m)
+	case []map[string]interface{}:
+		ret := make([]interface{}, 0, len(val))
+		for _, v0 := range val {
+			ret = append(ret, normalizeMap(v0))
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(val))
+		for _, v0 := range val {
+			if v0 = normalizeValue(v0); v0 != nil {
+				ret = append(ret, v0)
+			}
+		}
+		return ret
+	case int:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case float64:
+		if val == float64(int64(val)) {
+			return int64(val)
+		}
+		return val
+	case string, bool, int64, time.Time:
+		return val
+	case nil:
+		return nil
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,97 @@
+package env
+
+// 以default标签指定缺省值，不必先用字面量构造配置变量：
+//   type FooConfig struct {
+//       Bind    string        `default:":8080"`
+//       Timeout time.Duration `default:"5s"`
+//       Hosts   []string      `default:"a.local,b.local"` // slice以逗号分隔
+//       Retry   RetryConfig                                 // 嵌套结构体中的default标签同样生效
+//   }
+//   env.Register("foo", &FooConfig{})
+// 注册时对值为零值的字段设置标签中的缺省值，已用字面量设置的字段保持不变。
+// 缺省值与配置变量中的其他缺省值一样，作为每次载入配置的基础，并在Help和-gen-config中显示。
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// 对配置变量中值为零值、带default标签的字段设置缺省值，包括嵌套结构体。
+// parents为外层结构体类型，自引用的结构体指针不自动创建
+func applyDefaultTags(v reflect.Value, key string, parents ...reflect.Type) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || v.Type() == typeOfTime {
+		return nil
+	}
+	rt := v.Type()
+	parents = append(parents, rt)
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" && !f.Anonymous { //未导出的匿名嵌入结构体中的导出字段同样可以解码
+			continue
+		}
+		fv := v.Field(i)
+		fkey := key + "." + f.Name
+		if !fv.CanSet() {
+			if err := applyDefaultTags(fv, fkey, parents...); err != nil {
+				return err
+			}
+			continue
+		}
+		if def, ok := f.Tag.Lookup("default"); ok && isZeroValue(fv) {
+			if err := setFieldString(fv, def); err != nil {
+				return fmt.Errorf("%s: bad default %q|%v", fkey, def, err)
+			}
+		}
+		if f.Type.Kind() == reflect.Ptr && fv.IsNil() && !containsType(parents, f.Type.Elem()) &&
+			hasDefaultTags(f.Type.Elem(), nil) { //嵌套结构体指针为nil时创建
+			fv.Set(reflect.New(f.Type.Elem()))
+		}
+		if err := applyDefaultTags(fv, fkey, parents...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 结构体类型（包括嵌套结构体）中是否有default标签，seen用于跳过自引用的类型
+func hasDefaultTags(rt reflect.Type, seen map[reflect.Type]bool) bool {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct || rt == typeOfTime || seen[rt] {
+		return false
+	}
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	seen[rt] = true
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if _, ok := f.Tag.Lookup("default"); ok || hasDefaultTags(f.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []reflect.Type, rt reflect.Type) bool {
+	for _, t := range types {
+		if t == rt {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
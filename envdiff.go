@@ -0,0 +1,186 @@
+package env
+
+// 配置比较。发布前比较同一服务的两套配置，如dev和prod：
+//   xxx_svr -env dev -diff-config prod [-diff-format json]
+// 两套配置分别按启动时的规则载入本地配置文件（分层、include、解密、占位符解析），
+// 并展开路径变量后注入已注册的配置结构体，再逐个配置项比较，列出新增、删除和修改的配置项。
+// 只比较配置文件本身：不应用本进程的环境变量和命令行覆盖，不做校验；
+// 本机无法解析的占位符（如${env:PROD_DB_PW}）和无法解密的值按原文比较。
+// 结构体逐字段比较，map逐个key比较，slice作为整体比较。敏感配置项脱敏显示。
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+const (
+	DIFF_ADDED   = "added"   // 只在后一套配置中存在
+	DIFF_REMOVED = "removed" // 只在前一套配置中存在
+	DIFF_CHANGED = "changed"
+)
+
+// 一个配置项的差异
+type ConfigDiff struct {
+	Key  string      `json:"key"` // section.Field，map的key以.连接
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"` // 已脱敏
+	New  interface{} `json:"new,omitempty"`
+}
+
+// 展开后的配置项
+type flatValue struct {
+	raw     interface{} // 用于比较
+	display interface{} // 脱敏后用于显示
+}
+
+// 比较同一服务的两套配置，返回按配置项排序的差异
+func DiffConfig(serverName, fromConfig, toConfig string) ([]*ConfigDiff, error) {
+	e := defaultEnv
+	e.setBasePath(defaultBasePath())
+	return e.DiffConfig(serverName, fromConfig, toConfig)
+}
+
+func (e *Env) DiffConfig(serverName, fromConfig, toConfig string) ([]*ConfigDiff, error) {
+	from, err := e.flatConfig(serverName, fromConfig)
+	if err != nil {
+		return nil, fmt.Errorf("diff|%s|%v", fromConfig, err)
+	}
+	to, err := e.flatConfig(serverName, toConfig)
+	if err != nil {
+		return nil, fmt.Errorf("diff|%s|%v", toConfig, err)
+	}
+
+	keys := make(map[string]bool)
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var diffs []*ConfigDiff
+	for _, key := range sorted {
+		a, inFrom := from[key]
+		b, inTo := to[key]
+		switch {
+		case !inFrom:
+			diffs = append(diffs, &ConfigDiff{Key: key, Kind: DIFF_ADDED, New: b.display})
+		case !inTo:
+			diffs = append(diffs, &ConfigDiff{Key: key, Kind: DIFF_REMOVED, Old: a.display})
+		case !reflect.DeepEqual(a.raw, b.raw):
+			diffs = append(diffs, &ConfigDiff{Key: key, Kind: DIFF_CHANGED, Old: a.display, New: b.display})
+		}
+	}
+	return diffs, nil
+}
+
+// 载入一套本地配置（不影响当前配置），展开为 配置项 -> 值
+func (e *Env) flatConfig(serverName, configName string) (map[string]flatValue, error) {
+	e.initPathReplacer(serverName, configName)
+	layers, err := e.fileLoader(configLayers(e.ConfigPath(), serverName, configName))()
+	if err != nil {
+		return nil, err
+	}
+	sections, _, err := e.mergeLayers(layers, true)
+	if err != nil {
+		return nil, err
+	}
+	e.resolveSectionsLenient(sections)
+	e.expandSections(sections)
+	ret := make(map[string]flatValue)
+	for name, config := range sections {
+		flattenValue(reflect.ValueOf(config), name, false, ret)
+	}
+	return ret, nil
+}
+
+// 将配置变量展开为 配置项 -> 值，secret表示所在配置项需要脱敏
+func flattenValue(v reflect.Value, key string, secret bool, out map[string]flatValue) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			flattenValue(v.Elem(), key, secret, out)
+			return
+		}
+	case reflect.Struct:
+		if v.Type() != typeOfTime {
+			for _, f := range tomlFields(v.Type(), nil) { //与配置文件中的名字相同
+				if fv, ok := tomlFieldValue(v, f); ok {
+					flattenValue(fv, key+"."+tomlName(f), secret || isSecretField(f), out)
+				}
+			}
+			return
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			flattenValue(v.MapIndex(k), key+"."+name, secret || IsSecretName(name), out)
+		}
+		return
+	}
+
+	var raw interface{}
+	if v.IsValid() {
+		raw = v.Interface()
+	}
+	display := maskValue(v)
+	if secret {
+		display = maskSecret(display)
+	}
+	out[key] = flatValue{raw, display}
+}
+
+// 输出配置差异，format为text或json
+func WriteConfigDiff(w io.Writer, fromConfig, toConfig string, diffs []*ConfigDiff, format string) error {
+	switch format {
+	case "json":
+		if diffs == nil {
+			diffs = []*ConfigDiff{}
+		}
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"from":  fromConfig,
+			"to":    toConfig,
+			"diffs": diffs,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "text", "":
+	default:
+		return fmt.Errorf("unknown diff format %q, want text or json", format)
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromConfig, toConfig)
+	for _, d := range diffs {
+		switch d.Kind {
+		case DIFF_ADDED:
+			fmt.Fprintf(w, "+ %s = %s\n", d.Key, diffText(d.New))
+		case DIFF_REMOVED:
+			fmt.Fprintf(w, "- %s = %s\n", d.Key, diffText(d.Old))
+		case DIFF_CHANGED:
+			fmt.Fprintf(w, "~ %s = %s -> %s\n", d.Key, diffText(d.Old), diffText(d.New))
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "no differences")
+	}
+	return nil
+}
+
+func diffText(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,480 @@
+package env
+
+// 配置文档生成。遍历所有注册的配置结构体（包括嵌套结构体、slice和map），
+// 以缺省值生成JSON Schema、Markdown文档或带注释的TOML样例配置文件，
+// 能载入当前配置时，Markdown文档和样例配置的注释中同时列出当前值：
+//   xxx_svr -gen-config > etc/xxx_svr_dev.toml
+//   xxx_svr -gen-config -gen-format=markdown > doc/config.md
+//   xxx_svr -gen-config -gen-format=schema > doc/config.schema.json
+// 字段说明取自desc标签，校验规则取自validate标签，敏感配置项的缺省值不输出。
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配置项类型
+const (
+	KIND_STRING   = "string"
+	KIND_INTEGER  = "integer"
+	KIND_FLOAT    = "float"
+	KIND_BOOLEAN  = "boolean"
+	KIND_DURATION = "duration" // time.Duration，配置文件中写为"5s"
+	KIND_DATETIME = "datetime" // time.Time
+	KIND_ARRAY    = "array"
+	KIND_TABLE    = "table" // 结构体
+	KIND_MAP      = "map"
+	KIND_ANY      = "any"
+)
+
+// 一个配置项的说明
+type FieldDoc struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"` // Go类型
+	Kind     string      `json:"kind"`
+	Desc     string      `json:"desc,omitempty"`
+	Default  interface{} `json:"default,omitempty"` // 脱敏后的缺省值
+	Value    interface{} `json:"value,omitempty"`   // 脱敏后的当前值
+	Validate string      `json:"validate,omitempty"`
+	Secret   bool        `json:"secret,omitempty"`
+	Elem     *FieldDoc   `json:"elem,omitempty"`   // array元素或map值的类型
+	Fields   []*FieldDoc `json:"fields,omitempty"` // table的字段
+}
+
+// 一个section的说明
+type SectionDoc struct {
+	Name    string      `json:"name"`
+	Package string      `json:"package"` // 定义配置结构体的包
+	Fields  []*FieldDoc `json:"fields"`
+}
+
+// 返回所有注册的配置的说明，按section名排序
+func ConfigDocs() []*SectionDoc {
+	return defaultEnv.ConfigDocs()
+}
+
+func (e *Env) ConfigDocs() []*SectionDoc {
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	var docs []*SectionDoc
+	for _, name := range sortedKeys(e.tomlConfigMaps) {
+		cur := reflect.ValueOf(e.tomlConfigMaps[name])
+		for cur.Kind() == reflect.Ptr && !cur.IsNil() {
+			cur = cur.Elem()
+		}
+		v, ok := e.configDefaults[name]
+		if !ok {
+			v = cur
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		docs = append(docs, &SectionDoc{
+			Name:    name,
+			Package: v.Type().PkgPath(),
+			Fields:  structDocs(v.Type(), v, cur),
+		})
+	}
+	return docs
+}
+
+// 结构体各字段的说明，v为缺省值，cur为当前值，无值时为零Value
+// 字段名与解码相同，按toml标签命名，匿名嵌入的结构体展开
+func structDocs(rt reflect.Type, v, cur reflect.Value) []*FieldDoc {
+	var docs []*FieldDoc
+	for _, f := range tomlFields(rt, nil) {
+		var fv, fcur reflect.Value
+		if v.IsValid() {
+			fv, _ = tomlFieldValue(v, f)
+		}
+		if cur.IsValid() {
+			fcur, _ = tomlFieldValue(cur, f)
+		}
+		doc := typeDoc(f.Type, fv, fcur)
+		doc.Name = tomlName(f)
+		doc.Desc = f.Tag.Get("desc")
+		doc.Validate = f.Tag.Get("validate")
+		doc.Secret = isSecretField(f)
+		if doc.Secret {
+			doc.Default = maskSecret(doc.Default)
+			doc.Value = maskSecret(doc.Value)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func typeDoc(rt reflect.Type, v, cur reflect.Value) *FieldDoc {
+	doc := &FieldDoc{Type: rt.String()}
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+		v, cur = elemValue(v), elemValue(cur)
+	}
+
+	switch {
+	case rt == typeOfDuration:
+		doc.Kind = KIND_DURATION
+	case rt == typeOfTime:
+		doc.Kind = KIND_DATETIME
+	default:
+		switch rt.Kind() {
+		case reflect.String:
+			doc.Kind = KIND_STRING
+		case reflect.Bool:
+			doc.Kind = KIND_BOOLEAN
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			doc.Kind = KIND_INTEGER
+		case reflect.Float32, reflect.Float64:
+			doc.Kind = KIND_FLOAT
+		case reflect.Slice, reflect.Array:
+			doc.Kind = KIND_ARRAY
+			doc.Elem = typeDoc(rt.Elem(), reflect.Value{}, reflect.Value{})
+		case reflect.Map:
+			doc.Kind = KIND_MAP
+			doc.Elem = typeDoc(rt.Elem(), reflect.Value{}, reflect.Value{})
+		case reflect.Struct:
+			doc.Kind = KIND_TABLE
+			doc.Fields = structDocs(rt, v, cur)
+			return doc //缺省值记录在各字段上
+		default:
+			doc.Kind = KIND_ANY
+		}
+	}
+	if v.IsValid() && !(doc.Kind == KIND_DATETIME && v.Interface().(time.Time).IsZero()) {
+		doc.Default = maskValue(v)
+	}
+	if cur.IsValid() && !(doc.Kind == KIND_DATETIME && cur.Interface().(time.Time).IsZero()) {
+		doc.Value = maskValue(cur)
+	}
+	return doc
+}
+
+// 指针指向的值，为nil时返回零Value
+func elemValue(v reflect.Value) reflect.Value {
+	if !v.IsValid() || v.IsNil() {
+		return reflect.Value{}
+	}
+	return v.Elem()
+}
+
+// 按格式生成配置文档：toml（样例配置文件）、markdown、schema（JSON Schema）
+func GenConfig(w io.Writer, format string) error {
+	return defaultEnv.GenConfig(w, format)
+}
+
+func (e *Env) GenConfig(w io.Writer, format string) error {
+	docs := e.ConfigDocs()
+	switch format {
+	case "", "toml":
+		return WriteSampleConfig(w, docs)
+	case "markdown", "md":
+		return WriteConfigMarkdown(w, docs)
+	case "schema", "json":
+		return WriteConfigSchema(w, docs)
+	}
+	return fmt.Errorf("gen config|unknown format %q", format)
+}
+
+// 生成带注释的TOML样例配置文件
+func WriteSampleConfig(w io.Writer, docs []*SectionDoc) error {
+	var buf bytes.Buffer
+	buf.WriteString("# 由 -gen-config 生成的样例配置，值为缺省值\n")
+	for _, section := range docs {
+		fmt.Fprintf(&buf, "\n# 定义于%s\n", section.Package)
+		writeSampleTable(&buf, section.Name, section.Fields)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSampleTable(buf *bytes.Buffer, table string, fields []*FieldDoc) {
+	fmt.Fprintf(buf, "[%s]\n", table)
+	var subtables []*FieldDoc
+	for _, f := range fields { //TOML中子表必须在本表的配置项之后
+		if f.Kind == KIND_TABLE || f.Kind == KIND_MAP {
+			subtables = append(subtables, f)
+			continue
+		}
+		writeFieldComment(buf, f)
+		switch {
+		case f.Secret && f.Kind == KIND_STRING:
+			fmt.Fprintf(buf, "%s = \"\"\n", f.Name)
+		case f.Secret:
+			fmt.Fprintf(buf, "# %s = \n", f.Name)
+		case f.Default == nil && (f.Kind == KIND_DATETIME || f.Kind == KIND_ANY):
+			fmt.Fprintf(buf, "# %s = \n", f.Name)
+		default:
+			fmt.Fprintf(buf, "%s = %s\n", f.Name, sampleValue(f))
+		}
+	}
+	for _, f := range subtables {
+		buf.WriteString("\n")
+		writeFieldComment(buf, f)
+		if f.Kind == KIND_TABLE {
+			writeSampleTable(buf, table+"."+f.Name, f.Fields)
+			continue
+		}
+		fmt.Fprintf(buf, "[%s.%s]\n", table, f.Name)
+		m, _ := f.Default.(map[string]interface{})
+		if len(m) == 0 {
+			fmt.Fprintf(buf, "# key = %s\n", f.Elem.Kind)
+		}
+		for _, k := range sortedKeys(m) {
+			fmt.Fprintf(buf, "%s = %s\n", tomlKey(k), tomlValue(m[k]))
+		}
+	}
+}
+
+func writeFieldComment(buf *bytes.Buffer, f *FieldDoc) {
+	comment := f.Desc
+	if comment == "" {
+		comment = "<无描述>"
+	}
+	comment += " (" + f.Type
+	if f.Validate != "" {
+		comment += ", " + f.Validate
+	}
+	if f.Secret {
+		comment += ", 敏感配置项，可用env_crypt加密"
+	}
+	if f.Value != nil && !reflect.DeepEqual(f.Value, f.Default) {
+		comment += ", 当前值 " + tomlValue(f.Value)
+	}
+	fmt.Fprintf(buf, "# %s)\n", comment)
+}
+
+// 配置项在样例中的值，无缺省值时取零值
+func sampleValue(f *FieldDoc) string {
+	if f.Default != nil {
+		return tomlValue(f.Default)
+	}
+	switch f.Kind {
+	case KIND_STRING:
+		return `""`
+	case KIND_INTEGER:
+		return "0"
+	case KIND_FLOAT:
+		return "0.0"
+	case KIND_BOOLEAN:
+		return "false"
+	case KIND_DURATION:
+		return `"0s"`
+	}
+	return "[]"
+}
+
+// TOML格式的值，v为maskValue返回的通用结构
+func tomlValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return `""`
+	case string:
+		return tomlQuote(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case float32:
+		return tomlFloat(float64(val))
+	case float64:
+		return tomlFloat(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			items[i] = tomlValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		items := make([]string, 0, len(val))
+		for _, k := range sortedKeys(val) {
+			items = append(items, tomlKey(k)+" = "+tomlValue(val[k]))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String: //自定义字符串类型
+		return tomlQuote(rv.String())
+	case reflect.Float32, reflect.Float64:
+		return tomlFloat(rv.Float())
+	}
+	return fmt.Sprint(v)
+}
+
+func tomlFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+func tomlQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func tomlKey(k string) string {
+	for _, r := range k {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return tomlQuote(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
+
+// 生成Markdown格式的配置文档
+func WriteConfigMarkdown(w io.Writer, docs []*SectionDoc) error {
+	var buf bytes.Buffer
+	buf.WriteString("# 配置项\n")
+	for _, section := range docs {
+		fmt.Fprintf(&buf, "\n## [%s]\n\n定义于 `%s`\n\n", section.Name, section.Package)
+		buf.WriteString("| 配置项 | 类型 | 缺省值 | 当前值 | 说明 | 校验 |\n")
+		buf.WriteString("|---|---|---|---|---|---|\n")
+		writeMarkdownRows(&buf, "", section.Fields)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeMarkdownRows(buf *bytes.Buffer, prefix string, fields []*FieldDoc) {
+	for _, f := range fields {
+		name := prefix + f.Name
+		def, cur := "", ""
+		if f.Default != nil {
+			def = "`" + markdownEscape(tomlValue(f.Default)) + "`"
+		}
+		if f.Value != nil {
+			cur = "`" + markdownEscape(tomlValue(f.Value)) + "`"
+		}
+		fmt.Fprintf(buf, "| %s | `%s` | %s | %s | %s | %s |\n",
+			name, f.Type, def, cur, markdownEscape(f.Desc), markdownEscape(f.Validate))
+		switch {
+		case f.Kind == KIND_TABLE:
+			writeMarkdownRows(buf, name+".", f.Fields)
+		case f.Elem != nil && f.Elem.Kind == KIND_TABLE && f.Kind == KIND_ARRAY:
+			writeMarkdownRows(buf, name+"[].", f.Elem.Fields)
+		case f.Elem != nil && f.Elem.Kind == KIND_TABLE && f.Kind == KIND_MAP:
+			writeMarkdownRows(buf, name+".<key>.", f.Elem.Fields)
+		}
+	}
+}
+
+func markdownEscape(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+// 生成JSON Schema
+func WriteConfigSchema(w io.Writer, docs []*SectionDoc) error {
+	properties := make(map[string]interface{})
+	for _, section := range docs {
+		schema := tableSchema(section.Fields)
+		schema["description"] = "定义于" + section.Package
+		properties[section.Name] = schema
+	}
+	properties[INCLUDE_KEY] = map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "包含的配置文件",
+	}
+	schema := map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"type":       "object",
+		"properties": properties,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func tableSchema(fields []*FieldDoc) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for _, f := range fields {
+		properties[f.Name] = fieldSchema(f)
+		for _, rule := range strings.Split(f.Validate, ",") {
+			if strings.TrimSpace(rule) == "required" {
+				required = append(required, f.Name)
+			}
+		}
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func fieldSchema(f *FieldDoc) map[string]interface{} {
+	var schema map[string]interface{}
+	switch f.Kind {
+	case KIND_STRING:
+		schema = map[string]interface{}{"type": "string"}
+	case KIND_INTEGER:
+		schema = map[string]interface{}{"type": "integer"}
+	case KIND_FLOAT:
+		schema = map[string]interface{}{"type": "number"}
+	case KIND_BOOLEAN:
+		schema = map[string]interface{}{"type": "boolean"}
+	case KIND_DURATION:
+		schema = map[string]interface{}{"type": "string", "format": "duration"}
+	case KIND_DATETIME:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case KIND_ARRAY:
+		schema = map[string]interface{}{"type": "array", "items": fieldSchema(f.Elem)}
+	case KIND_MAP:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": fieldSchema(f.Elem)}
+	case KIND_TABLE:
+		schema = tableSchema(f.Fields)
+	default:
+		schema = map[string]interface{}{}
+	}
+	if f.Desc != "" {
+		schema["description"] = f.Desc
+	}
+	if f.Default != nil && !f.Secret {
+		schema["default"] = f.Default
+	}
+	for _, rule := range strings.Split(f.Validate, ",") {
+		rule = strings.TrimSpace(rule)
+		if strings.HasPrefix(rule, "oneof=") && f.Kind == KIND_STRING {
+			schema["enum"] = strings.Fields(rule[len("oneof="):])
+		}
+	}
+	return schema
+}
@@ -0,0 +1,49 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type docTestBase struct {
+	Level int `default:"2"`
+}
+
+type docTestConfig struct {
+	docTestBase
+	BindAddr string `toml:"bind_addr" default:":80"`
+	Skipped  string `toml:"-"`
+}
+
+// 生成的样例配置按toml标签命名，严格模式下可以直接载入
+func TestSampleConfigTomlNames(t *testing.T) {
+	gen := New()
+	gen.Register("gen", &docTestConfig{})
+	var buf bytes.Buffer
+	if err := gen.GenConfig(&buf, "toml"); err != nil {
+		t.Fatal(err)
+	}
+	sample := buf.String()
+	for _, s := range []string{"bind_addr = \":80\"", "Level = 2"} {
+		if !strings.Contains(sample, s) {
+			t.Errorf("sample missing %q:\n%s", s, sample)
+		}
+	}
+	if strings.Contains(sample, "BindAddr") || strings.Contains(sample, "Skipped") {
+		t.Errorf("sample uses field names:\n%s", sample)
+	}
+
+	e := New()
+	e.StrictConfig = true
+	e.Register("gen", &docTestConfig{})
+	if err := e.LoadTOML(sample); err != nil {
+		t.Fatalf("load sample: %v\n%s", err, sample)
+	}
+	if addr, err := e.GetString("gen.bind_addr"); err != nil || addr != ":80" {
+		t.Errorf("gen.bind_addr = %q, %v", addr, err)
+	}
+	if level, err := e.GetInt("gen.level"); err != nil || level != 2 {
+		t.Errorf("gen.level = %d, %v", level, err)
+	}
+}
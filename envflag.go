@@ -0,0 +1,182 @@
+package env
+
+// 命令行参数。env在flag.CommandLine上定义以下参数，由程序的flag.Parse()或InitEnv解析：
+//   -env prod           配置名，缺省为dev
+//   -config-dir DIR     配置文件目录，缺省为${BASE_PATH}/etc
+//   -base-path DIR      基准路径，缺省为程序所在目录的上级目录
+//   -print-config       显示所有配置项后退出
+//   -check-config       载入并校验配置后退出，配置有误时退出码为1
+//   -strict-config      存在未知配置项时拒绝启动，缺省只记录警告
+//   -gen-config         输出样例配置文件后退出，-gen-format可选toml、markdown、schema
+//   -diff-config prod   与-env指定的配置比较，列出差异后退出，-diff-format可选text、json
+//   -shutdown-timeout   收到SIGTERM/SIGINT后停止所有组件的总超时时间，缺省30s
+// 此外每个注册的配置项都有一个对应的参数，优先级高于配置文件和环境变量：
+//   -http.bind=:8080  -log.debugopen
+// 敏感配置项（见envsecret.go）没有对应的参数，以免出现在ps和/debug/vars的cmdline中，
+// 可在配置文件中加密，或用环境变量覆盖（环境变量的值也可以加密）。
+// 为兼容旧的启动方式，未指定-env时第一个非flag参数作为配置名；旧的"config"参数已由-print-config代替。
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	flagConfigName  string
+	flagConfigDir   string
+	flagBasePath    string
+	flagPrintConfig bool
+	flagCheckConfig bool
+	flagGenConfig   bool
+	flagGenFormat   string
+	flagDiffConfig  string
+	flagDiffFormat  string
+
+	fieldFlags []*fieldFlag // 配置项参数，按注册顺序排列
+)
+
+func init() {
+	flag.StringVar(&flagConfigName, "env", "", "配置名，如dev、prod，缺省为dev")
+	flag.StringVar(&flagConfigDir, "config-dir", "", "配置文件目录，缺省为${BASE_PATH}/etc")
+	flag.StringVar(&flagBasePath, "base-path", "", "基准路径，缺省为程序所在目录的上级目录")
+	flag.BoolVar(&flagPrintConfig, "print-config", false, "显示所有配置项后退出")
+	flag.BoolVar(&flagCheckConfig, "check-config", false, "载入并校验配置后退出")
+	flag.BoolVar(&flagGenConfig, "gen-config", false, "输出样例配置文件后退出")
+	flag.StringVar(&flagGenFormat, "gen-format", "toml", "-gen-config的输出格式：toml、markdown、schema")
+	flag.StringVar(&flagDiffConfig, "diff-config", "", "与指定的配置比较，列出差异后退出")
+	flag.StringVar(&flagDiffFormat, "diff-format", "text", "-diff-config的输出格式：text、json")
+}
+
+// 配置项参数，如 -http.bind
+type fieldFlag struct {
+	name   string   // 参数名
+	key    string   // section.Field
+	path   []string // section下的字段名路径
+	isBool bool
+	value  string
+	set    bool
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+func (f *fieldFlag) Set(s string) error {
+	f.value = s
+	f.set = true
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// 为配置结构体的每个字段定义命令行参数
+func defineFieldFlags(sectionName string, config interface{}) {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	defineStructFlags(v.Elem(), sectionName, nil)
+}
+
+// 参数名与配置文件中的名字相同（toml标签），匿名嵌入的结构体展开
+func defineStructFlags(v reflect.Value, sectionName string, fieldPath []string) {
+	for _, f := range tomlFields(v.Type(), nil) {
+		if isSecretField(f) { //命令行参数会出现在ps和/debug/vars的cmdline中
+			continue
+		}
+		fv, ok := tomlFieldValue(v, f)
+		if !ok {
+			continue
+		}
+		p := append(append([]string{}, fieldPath...), tomlName(f))
+		if fv.Kind() == reflect.Struct && fv.Type() != typeOfTime {
+			defineStructFlags(fv, sectionName, p)
+			continue
+		}
+
+		key := sectionName + "." + strings.Join(p, ".")
+		name := strings.ToLower(key)
+		if flag.Lookup(name) != nil { //重复注册时沿用已有参数
+			continue
+		}
+		ff := &fieldFlag{
+			name:   name,
+			key:    key,
+			path:   p,
+			isBool: fv.Kind() == reflect.Bool,
+			value:  fmt.Sprint(fv.Interface()),
+		}
+		flag.Var(ff, name, f.Tag.Get("desc"))
+		fieldFlags = append(fieldFlags, ff)
+	}
+}
+
+// 按配置项名路径查找字段，与解码相同按toml标签匹配，不区分大小写
+func lookupField(v reflect.Value, names []string) (reflect.Value, bool) {
+	for _, name := range names {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		f, ok := tomlField(v.Type(), name)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		if v, ok = tomlFieldValue(v, f); !ok {
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
+}
+
+// 用命令行参数覆盖各配置变量，覆盖的字段来源记录到sources
+func applyFlagOverrides(sections map[string]interface{}, sources map[string]string) error {
+	for _, ff := range fieldFlags {
+		if !ff.set {
+			continue
+		}
+		section := strings.SplitN(ff.key, ".", 2)[0]
+		config, ok := sections[section]
+		if !ok {
+			continue
+		}
+		fv, ok := lookupField(reflect.ValueOf(config), ff.path)
+		if !ok {
+			continue
+		}
+		err := setFieldString(fv, ff.value)
+		if err != nil {
+			return fmt.Errorf("flag override|-%s=%q|%v", ff.name, ff.value, err)
+		}
+		sources[strings.ToLower(ff.key)] = "flag -" + ff.name
+	}
+	return nil
+}
+
+// 从命令行参数取得配置名
+func flagConfig() (string, error) {
+	return configNameFromArgs(flagConfigName, flag.Args())
+}
+
+// 旧的"xxx_svr config prod"显示配置，现由-print-config代替，不能当作配置名载入
+func configNameFromArgs(name string, args []string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	if len(args) == 0 {
+		return "dev", nil
+	}
+	if args[0] == "config" {
+		return "", fmt.Errorf("config name|%q is no longer supported, use -print-config [-env NAME]|%v", "config", args)
+	}
+	return args[0], nil
+}
@@ -0,0 +1,24 @@
+package env
+
+import "testing"
+
+func TestConfigNameFromArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{"", nil, "dev", false},
+		{"prod", []string{"test"}, "prod", false},
+		{"", []string{"prod"}, "prod", false},
+		{"", []string{"config", "prod"}, "", true}, //旧的显示配置方式
+		{"config", nil, "config", false},           //-env明确指定时照常使用
+	}
+	for _, test := range tests {
+		got, err := configNameFromArgs(test.name, test.args)
+		if got != test.want || (err != nil) != test.err {
+			t.Errorf("configNameFromArgs(%q, %q) = %q, %v", test.name, test.args, got, err)
+		}
+	}
+}
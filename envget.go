@@ -0,0 +1,249 @@
+package env
+
+// 按配置项路径读取当前配置，不需要引用定义配置结构体的包：
+//   bind, ok := env.Get("http.Bind")
+//   timeout, err := env.GetDuration("db.Timeout")
+//   hosts, err := env.GetStringSlice("cache.Hosts")
+// 路径为 section.Field[.Field...]，map的key也以.连接，字段名与配置文件相同（有toml标签时为标签中的名字），不区分大小写。
+// Keys()列出所有叶子配置项，即展开结构体和map后的配置项，slice作为一个配置项。
+// GetMasked与Get相同，但敏感配置项已脱敏，用于对外展示。
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按路径查找配置项，secret表示路径上有敏感配置项
+func lookupPath(v reflect.Value, names []string) (ret reflect.Value, secret bool, ok bool) {
+	for _, name := range names {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			f, found := tomlField(v.Type(), name)
+			if !found {
+				return reflect.Value{}, false, false
+			}
+			secret = secret || isSecretField(f)
+			if v, found = tomlFieldValue(v, f); !found {
+				return reflect.Value{}, false, false
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false, false
+			}
+			key := reflect.ValueOf(name).Convert(v.Type().Key())
+			e := v.MapIndex(key)
+			if !e.IsValid() {
+				for _, k := range v.MapKeys() { //再按不区分大小写查找
+					if strings.EqualFold(k.String(), name) {
+						e = v.MapIndex(k)
+						break
+					}
+				}
+			}
+			if !e.IsValid() {
+				return reflect.Value{}, false, false
+			}
+			secret = secret || IsSecretName(name)
+			v = e
+		default:
+			return reflect.Value{}, false, false
+		}
+	}
+	return v, secret, true
+}
+
+// 在读锁内查找配置项并以fun处理，未找到时返回false
+func (e *Env) lookupKey(key string, fun func(v reflect.Value, secret bool)) bool {
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	parts := strings.Split(key, ".")
+	config, ok := e.tomlConfigMaps[parts[0]]
+	if !ok {
+		for name, c := range e.tomlConfigMaps {
+			if strings.EqualFold(name, parts[0]) {
+				config, ok = c, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return false
+	}
+	v, secret, ok := lookupPath(reflect.ValueOf(config), parts[1:])
+	if !ok {
+		return false
+	}
+	fun(v, secret)
+	return true
+}
+
+// 读取配置项的当前值，返回值为副本
+func Get(key string) (interface{}, bool) {
+	return defaultEnv.Get(key)
+}
+
+func (e *Env) Get(key string) (ret interface{}, ok bool) {
+	ok = e.lookupKey(key, func(v reflect.Value, secret bool) {
+		if v.IsValid() {
+			ret = deepCopy(v).Interface()
+		}
+	})
+	return
+}
+
+// 读取脱敏后的配置项，section或结构体返回脱敏后的通用map
+func GetMasked(key string) (interface{}, bool) {
+	return defaultEnv.GetMasked(key)
+}
+
+func (e *Env) GetMasked(key string) (ret interface{}, ok bool) {
+	ok = e.lookupKey(key, func(v reflect.Value, secret bool) {
+		ret = maskValue(v)
+		if secret {
+			ret = maskSecret(ret)
+		}
+	})
+	return
+}
+
+// 返回所有叶子配置项，按名称排序
+func Keys() []string {
+	return defaultEnv.Keys()
+}
+
+func (e *Env) Keys() []string {
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	flat := make(map[string]flatValue)
+	for name, config := range e.tomlConfigMaps {
+		flattenValue(reflect.ValueOf(config), name, false, flat)
+	}
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 读取配置项并解引用指针，未找到或为nil时返回错误
+func (e *Env) getValue(key string) (reflect.Value, error) {
+	var v reflect.Value
+	if !e.lookupKey(key, func(fv reflect.Value, secret bool) {
+		v = deepCopy(fv)
+	}) {
+		return v, fmt.Errorf("unknown config key %s", key)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, fmt.Errorf("config key %s is nil", key)
+		}
+		v = v.Elem()
+	}
+	return v, nil
+}
+
+func GetString(key string) (string, error) {
+	return defaultEnv.GetString(key)
+}
+
+func (e *Env) GetString(key string) (string, error) {
+	v, err := e.getValue(key)
+	if err != nil {
+		return "", err
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if v.Type() != typeOfTime {
+			return "", fmt.Errorf("config key %s is %s, not a scalar value", key, v.Type())
+		}
+	}
+	if v.Type() == typeOfDuration {
+		return time.Duration(v.Int()).String(), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// 读取整数配置项，字符串配置项按十进制解析
+func GetInt(key string) (int, error) {
+	return defaultEnv.GetInt(key)
+}
+
+func (e *Env) GetInt(key string) (int, error) {
+	v, err := e.getValue(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.String:
+		n, err := strconv.Atoi(strings.TrimSpace(v.String()))
+		if err != nil {
+			return 0, fmt.Errorf("config key %s|%v", key, err)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("config key %s is %s, not int", key, v.Type())
+}
+
+// 读取时间间隔配置项，字符串配置项按"5s"格式解析，整数配置项视为秒数
+func GetDuration(key string) (time.Duration, error) {
+	return defaultEnv.GetDuration(key)
+}
+
+func (e *Env) GetDuration(key string) (time.Duration, error) {
+	v, err := e.getValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if v.Type() == typeOfDuration {
+		return time.Duration(v.Int()), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Duration(v.Int()) * time.Second, nil
+	case reflect.String:
+		d, err := time.ParseDuration(strings.TrimSpace(v.String()))
+		if err != nil {
+			return 0, fmt.Errorf("config key %s|%v", key, err)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("config key %s is %s, not duration", key, v.Type())
+}
+
+// 读取字符串列表配置项，slice的元素转换为字符串，字符串配置项以逗号分隔
+func GetStringSlice(key string) ([]string, error) {
+	return defaultEnv.GetStringSlice(key)
+}
+
+func (e *Env) GetStringSlice(key string) ([]string, error) {
+	v, err := e.getValue(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		ret := make([]string, v.Len())
+		for i := range ret {
+			ret[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return ret, nil
+	case reflect.String:
+		return splitList(v.String()), nil
+	}
+	return nil, fmt.Errorf("config key %s is %s, not a list", key, v.Type())
+}
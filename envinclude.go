@@ -0,0 +1,88 @@
+package env
+
+// 配置文件包含。配置文件顶层的include列出需要包含的其他配置文件，用于多个服务共用相同的配置：
+//   include = ["common/log.toml", "${CONFIG_PATH}/db_${CONFIG_NAME}.toml"]
+// 规则如下：
+//   1. 文件名中可使用路径变量和${env:...}等占位符，相对路径相对于包含它的文件所在目录
+//   2. 被包含的文件作为单独的一层配置，先于包含它的文件合并，即包含它的文件覆盖被包含文件中的同名配置项
+//   3. 多个被包含文件按列出顺序合并，后面的覆盖前面的
+//   4. 被包含的文件可以继续包含其他文件，出现循环包含时报错
+//   5. 被包含的文件必须存在，其变化同样会触发重新加载
+// include也可以是单个字符串。YAML、JSON配置文件同样支持。
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const INCLUDE_KEY = "include"
+
+// 读取配置文件及其包含的文件，返回按覆盖顺序排列的各层配置。
+// stack为正在读取的文件，用于检测循环包含
+func (e *Env) includeLayers(filename string, stack []string) ([]configLayer, error) {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	for i, f := range stack {
+		if f == filename {
+			cycle := append(append([]string{}, stack[i:]...), filename)
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	stack = append(stack, filename)
+
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := popIncludes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var layers []configLayer
+	for _, include := range includes {
+		r := &placeholderResolver{env: e}
+		include, err = r.resolve(e.PathReplace(include))
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %s|%v", filename, include, err)
+		}
+		if !path.IsAbs(include) {
+			include = path.Join(path.Dir(filename), include)
+		}
+		included, err := e.includeLayers(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, included...)
+	}
+	return append(layers, configLayer{Source: "file " + filename, File: filename, Raw: raw}), nil
+}
+
+// 从配置中取出include列表
+func popIncludes(raw map[string]interface{}) ([]string, error) {
+	var includes []string
+	for k, v := range raw {
+		if !strings.EqualFold(k, INCLUDE_KEY) {
+			continue
+		}
+		delete(raw, k)
+		switch val := v.(type) {
+		case string:
+			includes = append(includes, val)
+		case []interface{}:
+			for _, item := range val {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("include must be a list of file names, got %v", item)
+				}
+				includes = append(includes, s)
+			}
+		default:
+			return nil, fmt.Errorf("include must be a list of file names, got %v", v)
+		}
+	}
+	return includes, nil
+}
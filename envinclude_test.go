@@ -0,0 +1,39 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		files map[string]string // 文件名 -> 内容，从main.toml开始读取
+		err   string            // 错误信息中应包含的内容
+	}{
+		{map[string]string{"main.toml": `include = "main.toml"`}, "include cycle: "},
+		{map[string]string{"main.toml": `include = "a.toml"`, "a.toml": `include = "b.toml"`, "b.toml": `include = "../x/a.toml"`}, "a.toml -> "},
+		{map[string]string{"main.toml": `include = "missing.toml"`}, "missing.toml"},
+		{map[string]string{"main.toml": `include = [1]`}, "include must be a list of file names"},
+		{map[string]string{"main.toml": `include = "${env:ENVREG_TEST_NOT_SET}.toml"`}, "not set"},
+	}
+	for i, test := range tests {
+		dir, err := ioutil.TempDir("", "envinclude")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		os.Mkdir(path.Join(dir, "x"), 0755)
+		for name, content := range test.files {
+			if err := ioutil.WriteFile(path.Join(dir, "x", name), []byte(content+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = New().includeLayers(path.Join(dir, "x", "main.toml"), nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d: err = %v, want %s", i, err, test.err)
+		}
+	}
+}
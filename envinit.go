@@ -0,0 +1,147 @@
+package env
+
+// 初始化顺序。Initializer可以命名并声明依赖的其他Initializer，InitEnv时按依赖关系
+// 拓扑排序后依次调用，没有依赖关系的按注册顺序调用：
+//   env.Register("http", httpConfig, env.DependsOn("log"))
+//   env.RegisterInitializerNamed("db", env.InitFunc(initDB), env.DependsOn("log"))
+// Register注册的配置结构体以section名作为Initializer名，未实现Initializer的以空的初始化方法占位。
+// 依赖不存在或存在循环依赖时报错。
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 已命名的Initializer
+type namedInitializer struct {
+	name        string
+	initializer Initializer
+	deps        []string
+}
+
+// 注册Initializer时的选项
+type InitOption func(*namedInitializer)
+
+// 声明依赖的Initializer名，依赖的Initializer先于本Initializer调用
+func DependsOn(names ...string) InitOption {
+	return func(ni *namedInitializer) {
+		ni.deps = append(ni.deps, names...)
+	}
+}
+
+// 注册一个命名的Initializer
+func RegisterInitializerNamed(name string, initializer Initializer, opts ...InitOption) {
+	defaultEnv.RegisterInitializerNamed(name, initializer, opts...)
+}
+
+func (e *Env) RegisterInitializerNamed(name string, initializer Initializer, opts ...InitOption) {
+	ni := &namedInitializer{name: name, initializer: initializer}
+	for _, opt := range opts {
+		opt(ni)
+	}
+	e.initializers = append(e.initializers, ni)
+}
+
+// 按依赖关系排序Initializer。依赖不存在或有循环依赖时返回错误
+func sortInitializers(nis []*namedInitializer) ([]*namedInitializer, error) {
+	byName := make(map[string]*namedInitializer)
+	for _, ni := range nis {
+		if ni.name == "" {
+			continue
+		}
+		if _, ok := byName[ni.name]; ok {
+			return nil, fmt.Errorf("initializer %q registered twice", ni.name)
+		}
+		byName[ni.name] = ni
+	}
+	for _, ni := range nis {
+		for _, dep := range ni.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("initializer %q depends on unknown initializer %q", ni.name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*namedInitializer]int)
+	var sorted []*namedInitializer
+	var stack []string
+	var visit func(ni *namedInitializer) error
+	visit = func(ni *namedInitializer) error {
+		switch state[ni] {
+		case visited:
+			return nil
+		case visiting: //从栈中找出环
+			i := len(stack) - 1
+			for i > 0 && stack[i] != ni.name {
+				i--
+			}
+			cycle := append(append([]string{}, stack[i:]...), ni.name)
+			return fmt.Errorf("initializer dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[ni] = visiting
+		stack = append(stack, ni.name)
+		for _, dep := range ni.deps {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[ni] = visited
+		sorted = append(sorted, ni)
+		return nil
+	}
+	for _, ni := range nis {
+		if err := visit(ni); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func (ni *namedInitializer) String() string {
+	if ni.name == "" {
+		return fmt.Sprintf("%T", ni.initializer)
+	}
+	return ni.name
+}
+
+// 返回Initializer的调用顺序
+func InitOrder() ([]string, error) {
+	return defaultEnv.InitOrder()
+}
+
+func (e *Env) InitOrder() ([]string, error) {
+	sorted, err := sortInitializers(e.initializers)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sorted))
+	for i, ni := range sorted {
+		names[i] = ni.String()
+	}
+	return names, nil
+}
+
+// 按依赖顺序调用所有Initializer
+func (e *Env) runInitializers() error {
+	sorted, err := sortInitializers(e.initializers)
+	if err != nil {
+		return err
+	}
+	for _, ni := range sorted {
+		logEnv.Debugf("init|%s", ni)
+		err = ni.initializer.Init()
+		if err != nil {
+			return fmt.Errorf("init %s|%v", ni, err)
+		}
+		if stopper := stopperOf(ni.initializer); stopper != nil { //Init成功后才需要停止
+			e.RegisterStopper(ni.String(), stopper)
+		}
+	}
+	return nil
+}
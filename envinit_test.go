@@ -0,0 +1,41 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortInitializersErrors(t *testing.T) {
+	noop := InitFunc(func() error { return nil })
+	node := func(name string, deps ...string) *namedInitializer {
+		return &namedInitializer{name: name, initializer: noop, deps: deps}
+	}
+	tests := []struct {
+		nodes []*namedInitializer
+		err   string
+	}{
+		{[]*namedInitializer{node("a"), node("a")}, `initializer "a" registered twice`},
+		{[]*namedInitializer{node("a", "b")}, `initializer "a" depends on unknown initializer "b"`},
+		{[]*namedInitializer{node("a", "a")}, "initializer dependency cycle: a -> a"},
+		{[]*namedInitializer{node("a", "b"), node("b", "c"), node("c", "a")}, "initializer dependency cycle: a -> b -> c -> a"},
+		{[]*namedInitializer{node("x"), node("a", "x", "b"), node("b", "a")}, "initializer dependency cycle: a -> b -> a"},
+	}
+	for i, test := range tests {
+		_, err := sortInitializers(test.nodes)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: err = %v, want %s", i, err, test.err)
+		}
+	}
+
+	sorted, err := sortInitializers([]*namedInitializer{node("c", "b"), node("a"), node("b", "a"), {initializer: noop}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ni := range sorted {
+		names = append(names, ni.name)
+	}
+	if strings.Join(names, ",") != "a,b,c," {
+		t.Errorf("order = %q", names)
+	}
+}
@@ -0,0 +1,159 @@
+package env
+
+// 配置实例。Env保存一组独立的配置注册表、路径变量和载入状态，包级函数（Register、
+// InitEnv、Reload等）都作用于缺省实例。测试中可以创建互不影响的实例：
+//   cfg := &FooConfig{Foo: "a"}
+//   e, err := env.NewFromTOML(`
+//   [foo]
+//   Foo = "b"
+//   `, map[string]interface{}{"foo": cfg})
+// 只有缺省实例使用命令行参数、配置注册中心，并同步包级变量BasePath、PathReplacer。
+// 缺省实例使用包级变量StrictConfig、ExpandVars、EnvPrefix，其他实例使用同名字段，
+// 创建时从包级变量复制，可在载入配置前修改。
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type Env struct {
+	BasePath     string            // 基准路径
+	ConfigDir    string            // 配置文件目录，为空时为${BASE_PATH}/etc
+	PathReplacer *strings.Replacer // 用于替换配置中的${...}变量
+
+	StrictConfig bool   // 严格模式，存在未知配置项时载入失败
+	ExpandVars   bool   // 载入配置后展开所有字符串配置项中的${...}变量
+	EnvPrefix    string // 覆盖配置的环境变量名前缀，为空时不用环境变量覆盖
+
+	isDefault bool // 缺省实例
+
+	tomlConfigMaps map[string]interface{}   // section名 -> 配置变量
+	configDefaults map[string]reflect.Value // 注册时配置变量的缺省值
+	initializers   []*namedInitializer
+	reloadables    []Reloadable
+
+	builtinVars    []string // 内置变量，old, new成对排列
+	customVars     map[string]string
+	customVarNames []string // 按注册顺序排列
+	varsLock       sync.Mutex
+
+	once          sync.Once
+	configFiles   []string          // 当前载入的本地配置文件，按覆盖顺序排列
+	configSources []string          // 当前载入的各层配置来源
+	currentLoader configLoader      // 当前配置的载入方式，重新加载时使用
+	fieldSources  map[string]string // section.field(小写) -> 配置来源，未记录的为缺省值
+	configLock    sync.RWMutex      // 替换配置变量时加写锁
+	reloadLock    sync.Mutex        // 串行执行重新加载
+
+	remoteVersion int64 // 已生效的注册中心配置版本
+	remoteLock    sync.Mutex
+
+	watchers     map[string][]WatchFunc // section名 -> 配置变化回调
+	watchQueue   []watchEvent           // 待调用的回调
+	watchRunning bool                   // 正在调用回调
+	watchLock    sync.Mutex
+
+	stoppers []namedStopper // 按启动顺序排列，退出时逆序停止
+	stopLock sync.Mutex
+	stopOnce sync.Once
+	stopDone chan struct{} // Shutdown完成后关闭
+	stopErr  error
+}
+
+var defaultEnv = newEnv(true)
+
+func newEnv(isDefault bool) *Env {
+	return &Env{
+		isDefault:      isDefault,
+		tomlConfigMaps: make(map[string]interface{}),
+		configDefaults: make(map[string]reflect.Value),
+		customVars:     make(map[string]string),
+		fieldSources:   make(map[string]string),
+		watchers:       make(map[string][]WatchFunc),
+		stopDone:       make(chan struct{}),
+	}
+}
+
+// 创建一个新的配置实例
+func New() *Env {
+	e := newEnv(false)
+	e.StrictConfig, e.ExpandVars, e.EnvPrefix = StrictConfig, ExpandVars, EnvPrefix
+	return e
+}
+
+// 缺省实例的选项由命令行参数或包级变量设置
+func (e *Env) strictConfig() bool {
+	if e.isDefault {
+		return StrictConfig
+	}
+	return e.StrictConfig
+}
+
+func (e *Env) expandVars() bool {
+	if e.isDefault {
+		return ExpandVars
+	}
+	return e.ExpandVars
+}
+
+func (e *Env) envPrefix() string {
+	if e.isDefault {
+		return EnvPrefix
+	}
+	return e.EnvPrefix
+}
+
+// 返回缺省实例
+func Default() *Env {
+	return defaultEnv
+}
+
+func (e *Env) setBasePath(basePath string) {
+	e.BasePath = basePath
+	if e.isDefault {
+		BasePath = basePath
+	}
+}
+
+// 载入<serverName>_<configName>配置并调用所有Initializer。需先设置BasePath或ConfigDir
+func (e *Env) Init(serverName, configName string) error {
+	e.initPathReplacer(serverName, configName)
+	err := e.loadConfig(e.configLoaderFor(serverName, configName))
+	if err != nil {
+		return err
+	}
+	return e.runInitializers()
+}
+
+// 以TOML字符串载入配置，不调用Initializer。与配置文件相同，会经过覆盖、解析和校验
+func (e *Env) LoadTOML(config string) error {
+	if e.PathReplacer == nil {
+		e.initPathReplacer("", "")
+	}
+	return e.loadConfig(func() ([]configLayer, error) {
+		raw, err := decodeTOML([]byte(config))
+		if err != nil {
+			return nil, err
+		}
+		return []configLayer{{Source: "string", Raw: normalizeMap(raw)}}, nil
+	})
+}
+
+// 创建一个新实例，注册sections中的配置变量（section名 -> 配置变量），
+// 以TOML字符串载入配置并调用Initializer。用于测试
+func NewFromTOML(config string, sections map[string]interface{}) (*Env, error) {
+	e := New()
+	for _, name := range sortedKeys(sections) {
+		e.Register(name, sections[name])
+	}
+	err := e.LoadTOML(config)
+	if err != nil {
+		return nil, err
+	}
+	err = e.runInitializers()
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,147 @@
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+type instanceTestConfig struct {
+	Host     string
+	Password string
+	DataDir  string
+}
+
+// 在临时目录中生成密钥和svr_dev.toml，密码以该目录的密钥加密
+func writeInstanceConfig(t *testing.T, host, password, extra string) string {
+	dir, err := ioutil.TempDir("", "envinstance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := GenerateConfigKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parseConfigKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptValue(key, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(dir, ConfigKeyFile), []byte(encoded+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := "[db]\nHost = \"" + host + "\"\nPassword = \"" + encrypted + "\"\nDataDir = \"${SERVER_NAME}/data\"\n" + extra
+	err = ioutil.WriteFile(path.Join(dir, "svr_dev.toml"), []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestInstancesIndependent(t *testing.T) {
+	if os.Getenv(ConfigKeyEnv) != "" || os.Getenv(ConfigKeyFileEnv) != "" {
+		t.Skip("config key set in environment")
+	}
+	dirA := writeInstanceConfig(t, "host-a", "password-a", "")
+	defer os.RemoveAll(dirA)
+	dirB := writeInstanceConfig(t, "host-b", "password-b", "Bnid = 1\n")
+	defer os.RemoveAll(dirB)
+	os.Setenv("TESTA_DB_HOST", "override-a")
+	defer os.Unsetenv("TESTA_DB_HOST")
+
+	a, dbA := New(), &instanceTestConfig{}
+	a.ConfigDir = dirA
+	a.EnvPrefix = "TESTA_"
+	a.StrictConfig = true
+	a.Register("db", dbA)
+
+	b, dbB := New(), &instanceTestConfig{}
+	b.ConfigDir = dirB
+	b.EnvPrefix = "TESTB_"
+	b.ExpandVars = true
+	b.Register("db", dbB)
+
+	if err := a.Init("svr", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Init("svr", "dev"); err != nil { //未知配置项只记录警告
+		t.Fatal(err)
+	}
+
+	// 各自的密钥、环境变量前缀和ExpandVars
+	if *dbA != (instanceTestConfig{"override-a", "password-a", "${SERVER_NAME}/data"}) {
+		t.Errorf("a: %+v", dbA)
+	}
+	if *dbB != (instanceTestConfig{"host-b", "password-b", "svr/data"}) {
+		t.Errorf("b: %+v", dbB)
+	}
+	if host, _ := a.GetString("db.Host"); host != "override-a" {
+		t.Errorf("a db.Host = %q", host)
+	}
+	if host, _ := b.GetString("db.Host"); host != "host-b" {
+		t.Errorf("b db.Host = %q", host)
+	}
+
+	// 严格模式只对设置了的实例生效
+	c := New()
+	c.ConfigDir = dirB
+	c.StrictConfig = true
+	c.Register("db", &instanceTestConfig{})
+	if err := c.Init("svr", "dev"); err == nil {
+		t.Error("strict instance loaded config with unknown key")
+	}
+	if StrictConfig || ExpandVars || EnvPrefix != "ENVREG_" {
+		t.Errorf("package options changed: StrictConfig=%v ExpandVars=%v EnvPrefix=%q", StrictConfig, ExpandVars, EnvPrefix)
+	}
+	if _, ok := defaultEnv.tomlConfigMaps["db"]; ok {
+		t.Error("section registered to default instance")
+	}
+}
+
+type tomlTestConfig struct {
+	Foo   string
+	Bar   []int
+	inits int
+}
+
+func (c *tomlTestConfig) Init() error {
+	c.inits++
+	if c.Foo == "fail" {
+		return fmt.Errorf("init failed")
+	}
+	return nil
+}
+
+// 内联TOML载入后调用Init，TOML和Init的错误都返回给调用者
+func TestNewFromTOML(t *testing.T) {
+	cfg := &tomlTestConfig{Foo: "a"}
+	e, err := NewFromTOML(`
+[foo]
+Foo = "b"
+Bar = [1, 2, 3]
+`, map[string]interface{}{"foo": cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Foo != "b" || len(cfg.Bar) != 3 || cfg.inits != 1 {
+		t.Fatalf("config: %+v", cfg)
+	}
+	if bar, err := e.GetStringSlice("foo.Bar"); err != nil || strings.Join(bar, ",") != "1,2,3" {
+		t.Errorf("foo.Bar = %v, %v", bar, err)
+	}
+
+	if _, err := NewFromTOML(`[foo]
+Foo = `, map[string]interface{}{"foo": &tomlTestConfig{}}); err == nil {
+		t.Error("bad TOML accepted")
+	}
+	if _, err := NewFromTOML("[foo]\nFoo = \"fail\"\n", map[string]interface{}{"foo": &tomlTestConfig{}}); err == nil || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("init error = %v", err)
+	}
+}
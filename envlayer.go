@@ -0,0 +1,121 @@
+package env
+
+// 分层配置。依次载入以下配置文件并深度合并，后面的文件覆盖前面的同名配置项：
+//   1. <server>_base.<ext>     公共配置（可选）
+//   2. <server>_<config>.<ext> 环境配置，如dev/prod（必需）
+//   3. <server>_local.<ext>    本机配置，不提交到代码库（可选）
+// 各文件用include包含的文件紧接在该文件之前合并（见envinclude.go）。
+// 合并时记录每个配置项来自哪个文件，可通过Help和expvar查看。
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	CONFIG_BASE  = "base"
+	CONFIG_LOCAL = "local"
+)
+
+// 返回需要载入的配置文件列表，按覆盖顺序排列
+func configLayers(dir, serverName, configName string) []string {
+	var files []string
+	if configName != CONFIG_BASE {
+		if f := findConfigFile(dir, serverName, CONFIG_BASE); fileExists(f) {
+			files = append(files, f)
+		}
+	}
+	files = append(files, findConfigFile(dir, serverName, configName))
+	if configName != CONFIG_LOCAL {
+		if f := findConfigFile(dir, serverName, CONFIG_LOCAL); fileExists(f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// 将src深度合并到dst，src中的配置项覆盖dst。
+// key按TOML的规则不区分大小写；被覆盖的配置项来源记录为source
+func mergeRaw(dst, src map[string]interface{}, keyPath, source string, sources map[string]string) {
+	for k, v := range src {
+		key := k
+		for k0 := range dst { // 沿用已有的key，避免同一配置项因大小写不同出现两次
+			if strings.EqualFold(k0, k) {
+				key = k0
+				break
+			}
+		}
+		fullKey := joinKey(keyPath, key)
+
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeRaw(dstMap, srcMap, fullKey, source, sources)
+			continue
+		}
+
+		clearSources(sources, fullKey)
+		if srcIsMap {
+			m := make(map[string]interface{})
+			mergeRaw(m, srcMap, fullKey, source, sources)
+			dst[key] = m
+			continue
+		}
+		dst[key] = v
+		sources[strings.ToLower(fullKey)] = source
+	}
+}
+
+func joinKey(keyPath, key string) string {
+	if keyPath == "" {
+		return key
+	}
+	return keyPath + "." + key
+}
+
+func clearSources(sources map[string]string, key string) {
+	key = strings.ToLower(key)
+	for k := range sources {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(sources, k)
+		}
+	}
+}
+
+// 查询配置项的来源。配置项为嵌套结构时，返回其下所有配置项的来源
+func lookupSource(sources map[string]string, key string) string {
+	key = strings.ToLower(key)
+	if src, ok := sources[key]; ok {
+		return src
+	}
+	var srcs []string
+	seen := make(map[string]bool)
+	for k, src := range sources {
+		if strings.HasPrefix(k, key+".") && !seen[src] {
+			seen[src] = true
+			srcs = append(srcs, src)
+		}
+	}
+	if len(srcs) == 0 {
+		return "default"
+	}
+	sort.Strings(srcs)
+	return strings.Join(srcs, ", ")
+}
+
+// 查询当前配置项的来源，key格式为 section.Field
+func FieldSource(key string) string {
+	return defaultEnv.FieldSource(key)
+}
+
+func (e *Env) FieldSource(key string) string {
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	return lookupSource(e.fieldSources, key)
+}
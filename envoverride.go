@@ -0,0 +1,160 @@
+package env
+
+// 环境变量覆盖配置。配置文件解析后，用进程环境变量覆盖已注册配置变量的字段。
+//
+// 环境变量名由前缀、section名和字段名组成，全部大写，以下划线连接，如
+//   [http] Bind       -> ENVREG_HTTP_BIND
+//   [log]  DebugOpen  -> ENVREG_LOG_DEBUGOPEN
+// 嵌套结构体字段继续追加字段名。字段可用env标签指定完整的环境变量名，
+// env:"-" 表示该字段不允许覆盖：
+//   type FooConfig struct {
+//      Password string `env:"FOO_DB_PASSWORD"`
+//   }
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var EnvPrefix = "ENVREG_" // 环境变量名前缀
+
+var (
+	typeOfDuration = reflect.TypeOf(time.Duration(0))
+	typeOfTime     = reflect.TypeOf(time.Time{})
+)
+
+func envName(parts ...string) string {
+	name := strings.ToUpper(strings.Join(parts, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// 用环境变量覆盖各配置变量，覆盖的字段来源记录到sources。prefix为空时不覆盖
+func applyEnvOverrides(sections map[string]interface{}, prefix string, sources map[string]string) error {
+	if prefix == "" {
+		return nil
+	}
+	for name, config := range sections {
+		v := reflect.ValueOf(config)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		err := overrideStruct(v.Elem(), name, envName(prefix+name), sources)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func overrideStruct(v reflect.Value, keyPath, envPath string, sources map[string]string) error {
+	rt := v.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" { //未导出字段
+			continue
+		}
+		tag := f.Tag.Get("env")
+		if tag == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		key := keyPath + "." + f.Name
+		name := envName(envPath, f.Name)
+		if tag != "" {
+			name = tag
+		}
+
+		if fv.Kind() == reflect.Struct && fv.Type() != typeOfTime {
+			err := overrideStruct(fv, key, name, sources)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		err := setFieldString(fv, s)
+		if err != nil {
+			return fmt.Errorf("env override|%s=%q|%v", name, s, err)
+		}
+		sources[strings.ToLower(key)] = "env " + name
+	}
+	return nil
+}
+
+// 将字符串转换为字段类型并赋值，支持字符串、整数、浮点数、布尔、time.Duration
+// 以及以逗号分隔的slice
+func setFieldString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFieldString(v.Elem(), s)
+	}
+
+	if v.Type() == typeOfDuration {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		if strings.TrimSpace(s) != "" {
+			items = strings.Split(s, ",")
+		}
+		sl := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			err := setFieldString(sl.Index(i), strings.TrimSpace(item))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
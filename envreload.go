@@ -0,0 +1,383 @@
+package env
+
+// 配置热加载。定时检查配置文件的修改时间，文件变化后重新解析配置，
+// 替换已注册的配置变量中可以从配置解码的字段（未导出字段和toml:"-"字段保持不变），
+// 并调用实现了Reloadable接口的配置结构体。
+// 解析失败时保留原有配置，只记录错误日志。
+// 替换在写锁内进行，在其他goroutine中（如处理请求时）读取配置变量需用RLock/RUnlock保护。
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"../log"
+	"../toolbox"
+)
+
+// 重新加载接口。如果配置结构体实现该接口，在配置文件变化并重新载入后就调用此接口
+type Reloadable interface {
+	Reload() error
+}
+
+// 重新加载函数，实现了Reloadable接口
+type ReloadFunc func() error
+
+func (f ReloadFunc) Reload() error {
+	return f()
+}
+
+var (
+	ReloadInterval = 5 * time.Second // 配置文件检查间隔，为0时不监视配置文件
+
+	logEnv = log.NewLogger("env")
+)
+
+func RegisterReloadable(reloadable Reloadable) { //注册实现了Reloadable的interface
+	defaultEnv.RegisterReloadable(reloadable)
+}
+
+func RegisterReloadFunc(fun ReloadFunc) { //注册实现Reloadable的func
+	defaultEnv.RegisterReloadable(fun)
+}
+
+func (e *Env) RegisterReloadable(reloadable Reloadable) {
+	e.reloadables = append(e.reloadables, reloadable)
+}
+
+// 读取配置时加读锁，避免读到重新加载中的配置
+func RLock() {
+	defaultEnv.RLock()
+}
+
+func RUnlock() {
+	defaultEnv.RUnlock()
+}
+
+func (e *Env) RLock() {
+	e.configLock.RLock()
+}
+
+func (e *Env) RUnlock() {
+	e.configLock.RUnlock()
+}
+
+func (e *Env) saveDefault(sectionName string, config interface{}) { //保存配置缺省值，重新加载时以此为基础解析
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	e.configDefaults[sectionName] = deepCopy(v.Elem())
+}
+
+// 深度复制一个值，复制后的值与原值不共享指针、slice和map
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(deepCopy(v.Elem()))
+		return p
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			c.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	}
+	return v
+}
+
+// 以注册时的缺省值生成一组新的配置变量
+func (e *Env) newSections() map[string]interface{} {
+	sections := make(map[string]interface{})
+	for name, config := range e.tomlConfigMaps {
+		d, ok := e.configDefaults[name]
+		if !ok {
+			sections[name] = config
+			continue
+		}
+		p := reflect.New(d.Type())
+		p.Elem().Set(deepCopy(d))
+		sections[name] = p.Interface()
+	}
+	return sections
+}
+
+// 一层配置及其来源
+type configLayer struct {
+	Source string                 // 来源描述，如 "file /path/xxx_svr_dev.toml"
+	File   string                 // 来自本地文件时为文件名
+	Raw    map[string]interface{} // 解析后的通用map
+	Remote *remoteLayer           // 来自注册中心时不为nil
+}
+
+// 配置载入方式，返回按覆盖顺序排列的各层配置
+type configLoader func() ([]configLayer, error)
+
+// 从本地配置文件载入，被包含的文件先于包含它的文件
+func (e *Env) fileLoader(filenames []string) configLoader {
+	return func() (layers []configLayer, err error) {
+		for _, filename := range filenames {
+			included, err := e.includeLayers(filename, nil)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, included...)
+		}
+		return
+	}
+}
+
+// 服务的配置载入方式：配置了注册中心时从注册中心载入，否则读取本地分层配置文件
+func (e *Env) configLoaderFor(serverName, configName string) configLoader {
+	loader := e.fileLoader(configLayers(e.ConfigPath(), serverName, configName))
+	if RegistryURL != "" && e.isDefault {
+		loader = e.remoteLoader(RegistryURL, serverName, configName, loader)
+	}
+	return loader
+}
+
+// 依次合并各层配置到一组新的配置变量，不影响当前配置。
+// sources记录各字段的来源文件或覆盖的环境变量
+func (e *Env) decodeLayers(layers []configLayer) (sections map[string]interface{}, sources map[string]string, err error) {
+	sections, sources, err = e.mergeLayers(layers, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = e.checkUnknownKeys(layers)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = applyEnvOverrides(sections, e.envPrefix(), sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.isDefault {
+		err = applyFlagOverrides(sections, sources)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = e.resolveSections(sections)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = e.decryptSections(sections)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.expandVars() {
+		e.expandSections(sections)
+	}
+	err = validateSections(sections, e.PathReplace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// 合并各层配置文件并解密后注入一组新的配置变量，不做覆盖、占位符解析和校验。
+// lenient为true时无法解密的值保持原样，用于比较本机没有密钥的配置
+func (e *Env) mergeLayers(layers []configLayer, lenient bool) (sections map[string]interface{}, sources map[string]string, err error) {
+	raw := make(map[string]interface{})
+	sources = make(map[string]string)
+	var names []string
+	for _, layer := range layers {
+		mergeRaw(raw, layer.Raw, "", layer.Source, sources)
+		names = append(names, layer.Source)
+	}
+	d := &rawDecrypter{env: e, lenient: lenient}
+	err = d.decryptMap(raw, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	sections = e.newSections()
+	_, err = decodeRawSections(raw, sections)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", strings.Join(names, ","), err)
+	}
+	return
+}
+
+// 将解析好的配置整体替换到已注册的配置变量，并记录本次载入的各层配置来源
+func (e *Env) applySections(sections map[string]interface{}, sources map[string]string, layers []configLayer) {
+	e.configLock.Lock()
+	defer e.configLock.Unlock()
+	e.fieldSources = sources
+	e.configFiles, e.configSources = nil, nil
+	for _, layer := range layers {
+		e.configSources = append(e.configSources, layer.Source)
+		if layer.File != "" {
+			e.configFiles = append(e.configFiles, layer.File)
+		}
+	}
+	for name, config := range sections {
+		dst := reflect.ValueOf(e.tomlConfigMaps[name])
+		src := reflect.ValueOf(config)
+		if dst.Kind() != reflect.Ptr || dst == src {
+			continue
+		}
+		if dst.Elem().Kind() == reflect.Struct {
+			copyDecodable(dst.Elem(), src.Elem())
+		} else {
+			dst.Elem().Set(src.Elem())
+		}
+	}
+}
+
+// 只复制可以从配置解码的字段（导出且toml标签不为"-"），
+// 保留Init等设置的未导出字段和toml:"-"字段，如连接池、句柄
+func copyDecodable(dst, src reflect.Value) {
+	rt := dst.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("toml")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct { //匿名嵌入的结构体按字段复制
+			copyDecodable(dst.Field(i), src.Field(i))
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+}
+
+// 载入配置到已注册的配置变量，并记录载入方式供重新加载
+func (e *Env) loadConfig(loader configLoader) error {
+	layers, err := loader()
+	if err != nil {
+		return err
+	}
+	sections, sources, err := e.decodeLayers(layers)
+	if err != nil {
+		return err
+	}
+	e.applySections(sections, sources, layers)
+	e.commitRemote(layers)
+	e.currentLoader = loader
+	return nil
+}
+
+// 重新载入配置文件，并调用所有Reloadable。
+// 配置文件解析失败时保留原有配置，返回错误。
+func Reload() error {
+	return defaultEnv.Reload()
+}
+
+func (e *Env) Reload() (err error) {
+	e.reloadLock.Lock()
+	defer e.reloadLock.Unlock()
+	if e.currentLoader == nil {
+		return fmt.Errorf("reload|config not loaded")
+	}
+	layers, err := e.currentLoader()
+	if err != nil {
+		logEnv.Errorf("reload|load|%v|keep previous config", err)
+		return
+	}
+	sections, sources, err := e.decodeLayers(layers)
+	if err != nil {
+		logEnv.Errorf("reload|decode|%v|keep previous config", err)
+		return
+	}
+	snapshot := e.watchedSnapshot()
+	e.applySections(sections, sources, layers) //include的文件可能增减
+	e.commitRemote(layers)
+	logEnv.Infof("reload|config reloaded")
+	e.notifyWatchers(snapshot)
+
+	for _, reloadable := range e.reloadables {
+		if rerr := callReload(reloadable); rerr != nil {
+			logEnv.Errorf("reload|%T|%v", reloadable, rerr)
+			err = rerr
+		}
+	}
+	return
+}
+
+func callReload(reloadable Reloadable) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic|%v", r)
+		}
+	}()
+	return reloadable.Reload()
+}
+
+func fileModTime(filename string) time.Time {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// 当前载入的本地配置文件
+func (e *Env) currentConfigFiles() []string {
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	return append([]string{}, e.configFiles...)
+}
+
+func (e *Env) watchConfig(interval time.Duration) { //定时检查配置文件，任一文件变化后重新载入
+	modTimes := make(map[string]time.Time)
+	for _, filename := range e.currentConfigFiles() {
+		modTimes[filename] = fileModTime(filename)
+	}
+	toolbox.Routine(func() error {
+		changed := false
+		for _, filename := range e.currentConfigFiles() { //每次重新读取，重新载入后include的文件可能增减
+			t := fileModTime(filename)
+			old, ok := modTimes[filename]
+			if !ok { //新增的文件，记录修改时间，不触发重新载入
+				modTimes[filename] = t
+				continue
+			}
+			if !t.IsZero() && !t.Equal(old) {
+				modTimes[filename] = t
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return e.Reload()
+	}, interval, logEnv)
+}
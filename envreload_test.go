@@ -0,0 +1,42 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+type reloadTestConfig struct {
+	Host  string
+	Pool  *int `toml:"-"`
+	state string
+}
+
+func (c *reloadTestConfig) Init() error {
+	n := 1
+	c.Pool, c.state = &n, "opened"
+	return nil
+}
+
+// 重新加载只替换可解码的字段，Init设置的状态保留，配置未变化时不触发Watch
+func TestReloadKeepsInitState(t *testing.T) {
+	c := &reloadTestConfig{}
+	e, err := NewFromTOML("[db]\nHost = \"a\"\n", map[string]interface{}{"db": c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired := make(chan bool, 1)
+	e.Watch("db", func(old, new interface{}) {
+		fired <- true
+	})
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Host != "a" || c.Pool == nil || c.state != "opened" {
+		t.Fatalf("after reload: %+v", c)
+	}
+	select {
+	case <-fired:
+		t.Fatal("watch called for unchanged config")
+	case <-time.After(100 * time.Millisecond): //回调在另一个goroutine中调用
+	}
+}
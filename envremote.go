@@ -0,0 +1,282 @@
+package env
+
+// 从配置注册中心载入配置。指定了注册中心地址时（-registry参数或环境变量ENVREG_REGISTRY_URL），
+// InitEnv从注册中心读取服务的配置，按与本地配置文件相同的方式注入已注册的配置变量，
+// 并在${VAR_PATH}下保存一份缓存。注册中心不可用时依次使用缓存、本地配置文件，
+// 日志中记录实际使用的配置来源。
+//
+// 启动后以长轮询(/watch)等待注册中心的配置变化，变化后重新载入配置，
+// 与本地配置文件变化一样，对内容变化的section调用Watch注册的回调（见envwatch.go）。Shutdown时停止长轮询。
+//
+// 注册中心的/get、/watch返回完整配置（含密码等敏感配置项），以ext.SignChecker校验签名。请求按apisign的规则签名：
+// 参数中加入_app、_t（时间戳）和_sign = md5(secret:按参数名排序的参数值...)。
+// app由-registry-app或环境变量ENVREG_REGISTRY_APP指定，secret只能由环境变量ENVREG_REGISTRY_SECRET指定，
+// 避免出现在ps和/debug/vars的cmdline中。
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	RegistryURL     string            // 注册中心API地址，如 http://registry:8787/api/registry
+	RegistryTimeout = 5 * time.Second // 请求注册中心的超时时间
+	RegistryApp     string            // 请求注册中心时签名使用的app
+	RegistrySecret  string            // 签名密钥
+)
+
+func init() {
+	flag.StringVar(&RegistryURL, "registry", os.Getenv("ENVREG_REGISTRY_URL"), "配置注册中心API地址")
+	flag.StringVar(&RegistryApp, "registry-app", os.Getenv("ENVREG_REGISTRY_APP"), "请求注册中心时签名使用的app，密钥由环境变量ENVREG_REGISTRY_SECRET指定")
+	RegistrySecret = os.Getenv("ENVREG_REGISTRY_SECRET")
+}
+
+// 为请求参数签名，未指定RegistryApp时不签名
+func signRegistryParams(params url.Values) {
+	if RegistryApp == "" {
+		return
+	}
+	params.Set("_app", RegistryApp)
+	params.Set("_t", fmt.Sprint(time.Now().Unix()))
+	params.Del("_sign")
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vs := []string{RegistrySecret}
+	for _, k := range keys {
+		vs = append(vs, params.Get(k))
+	}
+	sum := md5.Sum([]byte(strings.Join(vs, ":")))
+	params.Set("_sign", hex.EncodeToString(sum[:]))
+}
+
+// 注册中心返回的配置文档
+type remoteDocument struct {
+	Version  int64                  `json:"version"`
+	Sections map[string]interface{} `json:"sections"`
+}
+
+type remoteReply struct {
+	Retcode int             `json:"errno"`
+	Retmsg  string          `json:"errmsg"`
+	Data    *remoteDocument `json:"data"`
+}
+
+// 从注册中心读取配置文档
+func fetchRemoteConfig(registryURL, serverName, configName string) (doc *remoteDocument, err error) {
+	params := url.Values{}
+	params.Set("server", serverName)
+	params.Set("config", configName)
+	signRegistryParams(params)
+	client := &http.Client{Timeout: RegistryTimeout}
+	resp, err := client.Get(registryURL + "/get?" + params.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry|http status %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	reply := &remoteReply{}
+	err = json.Unmarshal(data, reply)
+	if err != nil {
+		return
+	}
+	if reply.Retcode != 0 || reply.Data == nil {
+		return nil, fmt.Errorf("registry|errno=%d|%s", reply.Retcode, reply.Retmsg)
+	}
+	return reply.Data, nil
+}
+
+func (e *Env) configCacheFile(serverName, configName string) string {
+	return path.Join(e.BasePath, PATH_VAR, fmt.Sprintf("%s_%s.registry.json", serverName, configName))
+}
+
+// 保存注册中心配置的本地缓存
+func writeConfigCache(filename string, sections map[string]interface{}) error {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sections, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// 从注册中心读取的配置，解析和校验通过并生效后才记录版本、写入本地缓存
+type remoteLayer struct {
+	version   int64
+	cache     map[string]interface{} // 写入缓存的原始配置
+	cacheFile string
+}
+
+// 配置生效后记录注册中心配置的版本并写入缓存
+func (e *Env) commitRemote(layers []configLayer) {
+	for _, layer := range layers {
+		r := layer.Remote
+		if r == nil {
+			continue
+		}
+		e.setRemoteVersion(r.version)
+		if err := writeConfigCache(r.cacheFile, r.cache); err != nil {
+			logEnv.Warnf("config source|write cache %s|%v", r.cacheFile, err)
+		}
+	}
+}
+
+// 依次从注册中心、本地缓存、fallback载入配置
+func (e *Env) remoteLoader(registryURL, serverName, configName string, fallback configLoader) configLoader {
+	cacheFile := e.configCacheFile(serverName, configName)
+	return func() ([]configLayer, error) {
+		doc, err := fetchRemoteConfig(registryURL, serverName, configName)
+		if err == nil {
+			logEnv.Infof("config source|remote|%s|version=%d", registryURL, doc.Version)
+			remote := &remoteLayer{doc.Version, doc.Sections, cacheFile}
+			return []configLayer{{Source: "remote " + registryURL, Raw: normalizeMap(doc.Sections), Remote: remote}}, nil
+		}
+		logEnv.Warnf("config source|remote %s unavailable|%v", registryURL, err)
+
+		raw, err := readRawConfig(cacheFile)
+		if err == nil {
+			logEnv.Infof("config source|cache|%s", cacheFile)
+			return []configLayer{{Source: "cache " + cacheFile, Raw: raw}}, nil
+		}
+		logEnv.Warnf("config source|cache %s unavailable|%v", cacheFile, err)
+
+		logEnv.Infof("config source|local file")
+		return fallback()
+	}
+}
+
+var (
+	RegistryWatchTimeout  = 60              // 长轮询等待秒数
+	RegistryRetryInterval = 5 * time.Second // 请求注册中心失败后的重试间隔
+)
+
+func (e *Env) setRemoteVersion(version int64) {
+	e.remoteLock.Lock()
+	defer e.remoteLock.Unlock()
+	e.remoteVersion = version
+}
+
+// 已生效的注册中心配置版本
+func (e *Env) currentRemoteVersion() int64 {
+	e.remoteLock.Lock()
+	defer e.remoteLock.Unlock()
+	return e.remoteVersion
+}
+
+type watchReply struct {
+	Retcode int    `json:"errno"`
+	Retmsg  string `json:"errmsg"`
+	Data    *struct {
+		Changed  bool            `json:"changed"`
+		Document *remoteDocument `json:"document"`
+	} `json:"data"`
+}
+
+// 长轮询注册中心，配置版本与version不同时返回新配置，超时未变化时返回nil。ctx取消时立即返回
+func watchRemoteConfig(ctx context.Context, registryURL, serverName, configName string, version int64) (doc *remoteDocument, err error) {
+	params := url.Values{}
+	params.Set("server", serverName)
+	params.Set("config", configName)
+	params.Set("version", fmt.Sprint(version))
+	params.Set("timeout", fmt.Sprint(RegistryWatchTimeout))
+	signRegistryParams(params)
+	client := &http.Client{Timeout: time.Duration(RegistryWatchTimeout)*time.Second + RegistryTimeout}
+	req, err := http.NewRequest("GET", registryURL+"/watch?"+params.Encode(), nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry watch|http status %d", resp.StatusCode)
+	}
+	reply := &watchReply{}
+	err = json.NewDecoder(resp.Body).Decode(reply)
+	if err != nil {
+		return
+	}
+	if reply.Retcode != 0 || reply.Data == nil {
+		return nil, fmt.Errorf("registry watch|errno=%d|%s", reply.Retcode, reply.Retmsg)
+	}
+	if !reply.Data.Changed {
+		return nil, nil
+	}
+	return reply.Data.Document, nil
+}
+
+// 启动监视注册中心，退出时停止
+func (e *Env) startRegistryWatch(registryURL, serverName, configName string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.RegisterStopper("registry watch", StopFunc(func(context.Context) error {
+		cancel()
+		return nil
+	}))
+	go e.watchRegistry(ctx, registryURL, serverName, configName)
+}
+
+// 等待d，ctx取消时返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// 长轮询注册中心，配置变化后重新载入，由Reload调用Watch注册的回调。ctx取消后返回
+func (e *Env) watchRegistry(ctx context.Context, registryURL, serverName, configName string) {
+	for ctx.Err() == nil {
+		version := e.currentRemoteVersion()
+		doc, err := watchRemoteConfig(ctx, registryURL, serverName, configName, version)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			logEnv.Warnf("registry watch|%v", err)
+			sleepContext(ctx, RegistryRetryInterval)
+			continue
+		}
+		if doc == nil { //超时未变化
+			continue
+		}
+		logEnv.Infof("registry watch|version %d -> %d", version, doc.Version)
+
+		err = e.Reload()
+		if err != nil || e.currentRemoteVersion() == version { //未生效，稍后重试
+			sleepContext(ctx, RegistryRetryInterval)
+		}
+	}
+	logEnv.Infof("registry watch|stopped")
+}
@@ -0,0 +1,179 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type remoteTestConfig struct {
+	Host string
+	Port int `validate:"min=1"`
+}
+
+// 模拟注册中心：/get返回当前配置，/watch在版本变化前短暂等待后返回未变化
+type fakeRegistry struct {
+	sync.Mutex
+	doc *remoteDocument
+}
+
+func (r *fakeRegistry) set(version int64, sections map[string]interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.doc = &remoteDocument{Version: version, Sections: sections}
+}
+
+func (r *fakeRegistry) get() *remoteDocument {
+	r.Lock()
+	defer r.Unlock()
+	return r.doc
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/get":
+		json.NewEncoder(w).Encode(map[string]interface{}{"errno": 0, "data": r.get()})
+	case "/watch":
+		version, _ := strconv.ParseInt(req.URL.Query().Get("version"), 10, 64)
+		deadline := time.Now().Add(200 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			if doc := r.get(); doc.Version != version {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"errno": 0,
+					"data":  map[string]interface{}{"changed": true, "document": doc},
+				})
+				return
+			}
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"errno": 0, "data": map[string]interface{}{"changed": false}})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestWatchRegistry(t *testing.T) {
+	registry := &fakeRegistry{}
+	registry.set(1, map[string]interface{}{
+		"db":    map[string]interface{}{"Host": "db1", "Port": 3306},
+		"cache": map[string]interface{}{"Host": "cache1", "Port": 6379},
+	})
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	basePath, err := ioutil.TempDir("", "envremote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basePath)
+
+	e := New()
+	e.setBasePath(basePath)
+	db, cache := &remoteTestConfig{}, &remoteTestConfig{}
+	e.Register("db", db)
+	e.Register("cache", cache)
+	changed := make(chan string, 10)
+	for _, name := range []string{"db", "cache"} {
+		section := name
+		e.Watch(section, func(old, new interface{}) {
+			changed <- section
+		})
+	}
+
+	fallback := func() ([]configLayer, error) {
+		t.Fatal("fallback loader called")
+		return nil, nil
+	}
+	err = e.loadConfig(e.remoteLoader(server.URL, "test_svr", "dev", fallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Host != "db1" || cache.Port != 6379 {
+		t.Fatalf("initial config: db=%+v cache=%+v", db, cache)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.watchRegistry(ctx, server.URL, "test_svr", "dev")
+		close(done)
+	}()
+
+	registry.set(2, map[string]interface{}{
+		"db":    map[string]interface{}{"Host": "db2", "Port": 3306},
+		"cache": map[string]interface{}{"Host": "cache1", "Port": 6379},
+	})
+	select {
+	case section := <-changed:
+		if section != "db" {
+			t.Fatalf("changed section %q, want db", section)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch callback not called")
+	}
+
+	e.configLock.RLock()
+	host := db.Host
+	e.configLock.RUnlock()
+	if host != "db2" {
+		t.Fatalf("db.Host = %q after reload, want db2", host)
+	}
+	if version := e.currentRemoteVersion(); version != 2 {
+		t.Fatalf("remote version = %d, want 2", version)
+	}
+	select {
+	case section := <-changed:
+		t.Fatalf("unexpected change of section %q", section)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchRegistry not stopped after cancel")
+	}
+}
+
+// 校验失败的配置不生效，也不写入缓存、不更新版本
+func TestRemoteConfigInvalid(t *testing.T) {
+	registry := &fakeRegistry{}
+	registry.set(3, map[string]interface{}{"db": map[string]interface{}{"Host": "db1", "Port": 0}})
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	basePath, err := ioutil.TempDir("", "envremote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basePath)
+
+	e := New()
+	e.setBasePath(basePath)
+	e.Register("db", &remoteTestConfig{})
+	fallback := func() ([]configLayer, error) {
+		t.Fatal("fallback loader called")
+		return nil, nil
+	}
+	err = e.loadConfig(e.remoteLoader(server.URL, "test_svr", "dev", fallback))
+	if err == nil {
+		t.Fatal("invalid remote config loaded")
+	}
+	if _, err := os.Stat(e.configCacheFile("test_svr", "dev")); !os.IsNotExist(err) {
+		t.Fatalf("cache written for invalid config: %v", err)
+	}
+	if version := e.currentRemoteVersion(); version != 0 {
+		t.Fatalf("remote version = %d, want 0", version)
+	}
+}
@@ -0,0 +1,189 @@
+package env
+
+// 配置值解析。配置中的字符串可以包含以下占位符，载入配置时替换为实际的值：
+//   ${env:DB_PASSWORD}          进程环境变量，未设置时报错
+//   ${file:/run/secrets/db}     文件内容（去掉末尾换行），文件名中可使用路径变量
+//   ${ref:mysql.Host}           另一个已注册section的配置项
+// 解析结果中的占位符会继续解析，出现循环引用时报错。
+// 占位符参数中的路径变量先替换。可用RegisterResolver增加新的占位符类型，未注册的类型保持原样。
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 占位符解析接口，arg为占位符中冒号后的内容
+type Resolver interface {
+	Resolve(arg string) (string, error)
+}
+
+// 解析函数，实现了Resolver接口
+type ResolverFunc func(arg string) (string, error)
+
+func (f ResolverFunc) Resolve(arg string) (string, error) {
+	return f(arg)
+}
+
+const REF_SCHEME = "ref" // 引用其他配置项，由env内部解析
+
+var (
+	resolvers = make(map[string]Resolver) // 占位符类型 -> 解析器
+
+	placeholderRegexp = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9_]*):((?:\$\{[^{}]*\}|[^{}])*)\}`) // 参数中可包含${...}路径变量
+)
+
+// 注册一种占位符解析器，scheme为占位符类型，如"vault"对应${vault:...}
+func RegisterResolver(scheme string, resolver Resolver) {
+	if scheme == REF_SCHEME {
+		panic("env: resolver scheme " + REF_SCHEME + " is reserved")
+	}
+	resolvers[scheme] = resolver
+}
+
+func RegisterResolverFunc(scheme string, fun ResolverFunc) {
+	RegisterResolver(scheme, fun)
+}
+
+func init() {
+	RegisterResolverFunc("env", resolveEnv)
+	RegisterResolverFunc("file", resolveFile)
+}
+
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s not set", name)
+	}
+	return value, nil
+}
+
+func resolveFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// 解析一组配置变量中的占位符
+type placeholderResolver struct {
+	env      *Env
+	sections map[string]interface{}
+	stack    []string // 正在解析的占位符，用于检测循环引用
+	lenient  bool     // 无法解析的占位符保持原样
+}
+
+func (e *Env) resolveSections(sections map[string]interface{}) error {
+	return e.resolveSectionsWith(&placeholderResolver{env: e, sections: sections})
+}
+
+// 解析占位符，无法解析的（如本机未设置的环境变量）保持原样，用于比较其他环境的配置
+func (e *Env) resolveSectionsLenient(sections map[string]interface{}) {
+	e.resolveSectionsWith(&placeholderResolver{env: e, sections: sections, lenient: true})
+}
+
+func (e *Env) resolveSectionsWith(r *placeholderResolver) error {
+	sections := r.sections
+	for _, name := range sortedKeys(sections) {
+		err := walkStrings(reflect.ValueOf(sections[name]), name, func(key, s string) (string, error) {
+			ret, err := r.resolve(s)
+			if err != nil {
+				return "", fmt.Errorf("resolve %s|%v", key, err)
+			}
+			return ret, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *placeholderResolver) resolve(s string) (ret string, err error) {
+	ret = placeholderRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if err != nil {
+			return placeholder
+		}
+		m := placeholderRegexp.FindStringSubmatch(placeholder)
+		var value string
+		value, err = r.resolveOne(m[1], m[2])
+		if err != nil {
+			if r.lenient {
+				err = nil
+			}
+			return placeholder
+		}
+		return value
+	})
+	return
+}
+
+func (r *placeholderResolver) resolveOne(scheme, arg string) (string, error) {
+	var resolver Resolver
+	if scheme != REF_SCHEME {
+		var ok bool
+		resolver, ok = resolvers[scheme]
+		if !ok { //未注册的类型保持原样
+			return "${" + scheme + ":" + arg + "}", nil
+		}
+	}
+
+	name := scheme + ":" + arg
+	for i, s := range r.stack {
+		if s == name {
+			cycle := append(append([]string{}, r.stack[i:]...), name)
+			return "", fmt.Errorf("placeholder cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	r.stack = append(r.stack, name)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	var value string
+	var err error
+	if resolver == nil {
+		value, err = r.resolveRef(arg)
+	} else {
+		value, err = resolver.Resolve(r.env.PathReplace(arg))
+	}
+	if err != nil {
+		return "", fmt.Errorf("${%s}: %v", name, err)
+	}
+	return r.resolve(value) //解析结果中的占位符
+}
+
+// 取得另一个配置项的值，ref格式为 section.Field
+func (r *placeholderResolver) resolveRef(ref string) (string, error) {
+	parts := strings.Split(ref, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("bad reference, want section.Field")
+	}
+	config, ok := r.sections[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("unknown section %s", parts[0])
+	}
+	v, ok := lookupField(reflect.ValueOf(config), parts[1:])
+	if !ok {
+		return "", fmt.Errorf("unknown field %s", ref)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if v.Type() != typeOfTime {
+			return "", fmt.Errorf("%s is not a scalar value", ref)
+		}
+	}
+	if v.Type() == typeOfDuration {
+		return time.Duration(v.Int()).String(), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,42 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+type resolveTestConfig struct {
+	A string
+	B string
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		err  string // 错误信息中应包含的内容
+	}{
+		{"${ref:r.A}", "", "placeholder cycle: ref:r.A -> ref:r.A"},
+		{"${ref:r.B}", "${ref:r.A}", "placeholder cycle: ref:r.B -> ref:r.A -> ref:r.B"},
+		{"x${ref:r.B}", "${ref:r.B}", "placeholder cycle: ref:r.B -> ref:r.B"},
+		{"${ref:r}", "", "bad reference"},
+		{"${ref:none.A}", "", "unknown section none"},
+		{"${ref:r.C}", "", "unknown field r.C"},
+		{"${env:ENVREG_TEST_NOT_SET}", "", "environment variable ENVREG_TEST_NOT_SET not set"},
+	}
+	for i, test := range tests {
+		e := New()
+		sections := map[string]interface{}{"r": &resolveTestConfig{A: test.a, B: test.b}}
+		err := e.resolveSections(sections)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d: err = %v, want %s", i, err, test.err)
+		}
+	}
+
+	c := &resolveTestConfig{A: "${ref:r.B}/a", B: "b${unknown:x}"}
+	if err := New().resolveSections(map[string]interface{}{"r": c}); err != nil {
+		t.Fatal(err)
+	}
+	if c.A != "b${unknown:x}/a" {
+		t.Errorf("A = %q", c.A)
+	}
+}
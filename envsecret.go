@@ -0,0 +1,117 @@
+package env
+
+// 敏感配置项脱敏。带secret:"true"标签的字段，或字段名（map的key）看起来像密码、
+// 密钥的配置项，在Help和expvar输出中显示为******，程序中读取的仍是真实值，也不定义对应的命令行参数。
+// 名字像密钥但并非敏感信息的字段可用secret:"false"取消脱敏：
+//   type DBConfig struct {
+//      Password string `secret:"true"`
+//      Auth     string `secret:"true"`
+//      TokenTTL int    `secret:"false"`
+//   }
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const MASK = "******" // 脱敏后显示的值
+
+// 字段名包含以下内容（不区分大小写）时视为敏感配置项
+var SecretNamePatterns = []string{
+	"password", "passwd", "pwd", "secret", "token",
+	"privatekey", "keyfile", "apikey", "accesskey",
+}
+
+// 字段名或map的key是否像敏感配置项
+func IsSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range SecretNamePatterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretField(f reflect.StructField) bool {
+	switch f.Tag.Get("secret") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return IsSecretName(f.Name)
+}
+
+// 敏感配置项的值脱敏，空值保持原样以便看出是否已配置
+func maskSecret(v interface{}) interface{} {
+	if v == nil || fmt.Sprint(v) == "" {
+		return v
+	}
+	return MASK
+}
+
+// 将配置变量转换为脱敏后的通用结构，用于展示
+func maskValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return maskValue(v.Elem())
+	case reflect.Struct:
+		if v.Type() == typeOfTime {
+			return v.Interface()
+		}
+		m := make(map[string]interface{})
+		for _, f := range tomlFields(v.Type(), nil) { //与配置文件中的名字相同
+			fv, ok := tomlFieldValue(v, f)
+			if !ok {
+				continue
+			}
+			val := maskValue(fv)
+			if isSecretField(f) {
+				val = maskSecret(val)
+			}
+			m[tomlName(f)] = val
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{})
+		for _, key := range v.MapKeys() {
+			k := fmt.Sprint(key.Interface())
+			val := maskValue(v.MapIndex(key))
+			if IsSecretName(k) {
+				val = maskSecret(val)
+			}
+			m[k] = val
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		l := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			l[i] = maskValue(v.Index(i))
+		}
+		return l
+	}
+	if v.Type() == typeOfDuration {
+		return time.Duration(v.Int()).String()
+	}
+	return v.Interface()
+}
+
+// 返回所有配置的脱敏副本
+func (e *Env) maskedSections() map[string]interface{} {
+	ret := make(map[string]interface{}, len(e.tomlConfigMaps))
+	for name, config := range e.tomlConfigMaps {
+		ret[name] = maskValue(reflect.ValueOf(config))
+	}
+	return ret
+}
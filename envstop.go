@@ -0,0 +1,184 @@
+package env
+
+// 停止顺序。Register注册的配置变量实现了Stopper或Closer时，在Init成功后记录，
+// 退出时按Init的相反顺序停止，先停止依赖其他组件的组件；运行中启动的组件可用RegisterStopper注册：
+//   env.RegisterStopFunc("http server", server.Shutdown)
+// InitEnv后收到SIGTERM/SIGINT时调用Shutdown，所有组件停止后退出进程，再次收到信号时立即退出。
+// 所有组件共用-shutdown-timeout指定的总超时时间，超时后不再等待剩余的组件。
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 需要停止的组件。ctx在总超时时间到达时取消
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// 停止函数，实现了Stopper接口
+type StopFunc func(ctx context.Context) error
+
+func (f StopFunc) Stop(ctx context.Context) error {
+	return f(ctx)
+}
+
+// 需要关闭的组件，不支持超时
+type Closer interface {
+	Close() error
+}
+
+type closerStopper struct {
+	closer Closer
+}
+
+func (c closerStopper) Stop(ctx context.Context) error {
+	return c.closer.Close()
+}
+
+// 已命名的Stopper
+type namedStopper struct {
+	name    string
+	stopper Stopper
+}
+
+var (
+	ShutdownTimeout = 30 * time.Second // 停止所有组件的总超时时间
+	HandleSignals   = true             // InitEnv时是否处理SIGTERM/SIGINT
+)
+
+func init() {
+	flag.DurationVar(&ShutdownTimeout, "shutdown-timeout", ShutdownTimeout, "退出时停止所有组件的总超时时间")
+}
+
+// 配置变量实现了Stopper或Closer时返回对应的Stopper
+func stopperOf(v interface{}) Stopper {
+	switch s := v.(type) {
+	case Stopper:
+		return s
+	case Closer:
+		return closerStopper{s}
+	}
+	return nil
+}
+
+// 注册一个需要在退出时停止的组件，先注册的后停止
+func RegisterStopper(name string, stopper Stopper) {
+	defaultEnv.RegisterStopper(name, stopper)
+}
+
+func (e *Env) RegisterStopper(name string, stopper Stopper) {
+	e.stopLock.Lock()
+	defer e.stopLock.Unlock()
+	e.stoppers = append(e.stoppers, namedStopper{name, stopper})
+}
+
+func RegisterStopFunc(name string, fun StopFunc) {
+	RegisterStopper(name, fun)
+}
+
+func RegisterCloser(name string, closer Closer) {
+	RegisterStopper(name, closerStopper{closer})
+}
+
+// 返回组件的停止顺序
+func StopOrder() []string {
+	return defaultEnv.StopOrder()
+}
+
+func (e *Env) StopOrder() []string {
+	e.stopLock.Lock()
+	defer e.stopLock.Unlock()
+	names := make([]string, len(e.stoppers))
+	for i, ns := range e.stoppers {
+		names[len(names)-1-i] = ns.name
+	}
+	return names
+}
+
+// 按注册的相反顺序停止所有组件，总时间不超过ShutdownTimeout。
+// 只执行一次，重复调用时等待第一次调用完成并返回相同的结果
+func Shutdown() error {
+	return defaultEnv.Shutdown()
+}
+
+func (e *Env) Shutdown() error {
+	e.stopOnce.Do(func() {
+		e.stopErr = e.stopAll(ShutdownTimeout)
+		close(e.stopDone)
+	})
+	return e.stopErr
+}
+
+// 等待Shutdown完成。用于在组件停止后返回，如httputil.Listen
+func WaitShutdown() {
+	defaultEnv.WaitShutdown()
+}
+
+func (e *Env) WaitShutdown() {
+	<-e.stopDone
+}
+
+func (e *Env) stopAll(timeout time.Duration) error {
+	e.stopLock.Lock()
+	stoppers := e.stoppers
+	e.stopLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []string
+	for i := len(stoppers) - 1; i >= 0; i-- {
+		ns := stoppers[i]
+		logEnv.Infof("stop|%s", ns.name)
+		done := make(chan error, 1)
+		go func() {
+			done <- ns.stopper.Stop(ctx)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				logEnv.Errorf("stop %s|%v", ns.name, err)
+				errs = append(errs, fmt.Sprintf("%s: %v", ns.name, err))
+			}
+		case <-ctx.Done():
+			var remaining []string
+			for j := i; j >= 0; j-- {
+				remaining = append(remaining, stoppers[j].name)
+			}
+			logEnv.Errorf("shutdown timeout %v|not stopped: %s", timeout, strings.Join(remaining, ", "))
+			errs = append(errs, fmt.Sprintf("timeout after %v, not stopped: %s", timeout, strings.Join(remaining, ", ")))
+			return fmt.Errorf("shutdown|%s", strings.Join(errs, "; "))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown|%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// 收到SIGTERM/SIGINT时停止所有组件并退出进程
+func (e *Env) handleSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-c
+	logEnv.Infof("received signal %v, shutting down", sig)
+	go func() {
+		sig := <-c
+		logEnv.Errorf("received signal %v again, exit now", sig)
+		os.Exit(1)
+	}()
+
+	code := 0
+	if err := e.Shutdown(); err != nil {
+		code = 1
+	}
+	logEnv.Info("shutdown complete")
+	os.Exit(code)
+}
@@ -0,0 +1,195 @@
+package env
+
+// 未知配置项检查。配置文件中未注册的section，以及配置结构体中不存在的字段（如把Bind误写为Bnid）
+// 在载入时报告，并给出所在文件和行号：
+//   file /path/etc/xxx_svr_dev.toml:12: unknown key http.Bnid
+// 配置项与字段的对应规则与解码相同：按toml标签或字段名匹配，不区分大小写。
+// 缺省只记录警告日志；严格模式（-strict-config参数或StrictConfig = true）下作为错误，
+// 启动时panic，重新加载时保留原有配置。
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var StrictConfig bool // 严格模式，存在未知配置项时载入失败
+
+func init() {
+	flag.BoolVar(&StrictConfig, "strict-config", false, "存在未知配置项时拒绝启动")
+}
+
+// 未知配置项错误，每一项为 来源:行号: 说明
+type UnknownKeysError []string
+
+func (e UnknownKeysError) Error() string {
+	return "unknown config keys:\n  " + strings.Join(e, "\n  ")
+}
+
+// 检查各层配置中的未知section和配置项。严格模式下返回错误，否则记录警告
+func (e *Env) checkUnknownKeys(layers []configLayer) error {
+	var unknown UnknownKeysError
+	for _, layer := range layers {
+		for _, name := range sortedKeys(layer.Raw) {
+			var keys []string
+			config, ok := e.tomlConfigMaps[name]
+			if !ok {
+				keys = append(keys, name)
+			} else {
+				keys = unknownKeys(layer.Raw[name], reflect.TypeOf(config), name, keys)
+			}
+			for _, key := range keys {
+				unknown = append(unknown, describeUnknownKey(layer, key, !ok))
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if e.strictConfig() {
+		return unknown
+	}
+	for _, s := range unknown {
+		logEnv.Warnf("config|%s", s)
+	}
+	return nil
+}
+
+// 按配置变量的类型检查配置值，返回类型中不存在的配置项
+func unknownKeys(v interface{}, rt reflect.Type, keyPath string, keys []string) []string {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok || rt == typeOfTime {
+			return keys
+		}
+		for _, k := range sortedKeys(m) {
+			f, ok := tomlField(rt, k)
+			if !ok {
+				keys = append(keys, joinKey(keyPath, k))
+				continue
+			}
+			keys = unknownKeys(m[k], f.Type, joinKey(keyPath, k), keys)
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for _, k := range sortedKeys(m) {
+				keys = unknownKeys(m[k], rt.Elem(), joinKey(keyPath, k), keys)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if l, ok := v.([]interface{}); ok {
+			for i, item := range l {
+				keys = unknownKeys(item, rt.Elem(), fmt.Sprintf("%s[%d]", keyPath, i), keys)
+			}
+		}
+	}
+	return keys
+}
+
+// 按TOML解码的规则查找配置项对应的字段：字段名或toml标签中的名字，先精确匹配再不区分大小写，
+// 匿名嵌入且没有toml标签的结构体展开查找
+func tomlField(rt reflect.Type, key string) (reflect.StructField, bool) {
+	var fold reflect.StructField
+	found := false
+	for _, f := range tomlFields(rt, nil) {
+		name := tomlName(f)
+		if name == key {
+			return f, true
+		}
+		if !found && strings.EqualFold(name, key) {
+			fold, found = f, true
+		}
+	}
+	return fold, found
+}
+
+// 字段在配置文件中的名字：toml标签中的名字，没有标签时为字段名
+func tomlName(f reflect.StructField) string {
+	if tag := strings.Split(f.Tag.Get("toml"), ",")[0]; tag != "" {
+		return tag
+	}
+	return f.Name
+}
+
+// 取tomlFields返回的字段的值，经过的匿名嵌入指针为nil时返回false
+func tomlFieldValue(v reflect.Value, f reflect.StructField) (reflect.Value, bool) {
+	fv, err := v.FieldByIndexErr(f.Index)
+	return fv, err == nil
+}
+
+// 结构体中可以解码的字段，index为外层匿名字段的下标
+func tomlFields(rt reflect.Type, index []int) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("toml")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, tomlFields(ft, append(append([]int{}, index...), i))...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		f.Index = append(append([]int{}, index...), i)
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func describeUnknownKey(layer configLayer, key string, isSection bool) string {
+	source := layer.Source
+	if layer.File != "" {
+		if line := keyLine(layer.File, key); line > 0 {
+			source = fmt.Sprintf("%s:%d", source, line)
+		}
+	}
+	if isSection {
+		return fmt.Sprintf("%s: unknown section [%s]", source, key)
+	}
+	return fmt.Sprintf("%s: unknown key %s", source, key)
+}
+
+var keyIndexRegexp = regexp.MustCompile(`\[\d+\]`)
+
+// 在配置文件中查找配置项所在的行号，找不到时返回0。
+// 按key的各级名字依次向后查找，适用于TOML、YAML和JSON
+func keyLine(filename, key string) int {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+	text := string(data)
+	offset, start := 0, -1
+	for _, name := range strings.Split(keyIndexRegexp.ReplaceAllString(key, ""), ".") {
+		re, err := regexp.Compile(`(?im)(^|[\s\[.{,"'])["']?` + regexp.QuoteMeta(name) + `["']?\s*([\].=:]|$)`)
+		if err != nil {
+			return 0
+		}
+		loc := re.FindStringIndex(text[offset:])
+		if loc == nil {
+			return 0
+		}
+		start, offset = offset+loc[0], offset+loc[1]
+	}
+	if start < 0 {
+		return 0
+	}
+	if text[start] == '\n' { //匹配到了上一行的换行符
+		start++
+	}
+	return strings.Count(text[:start], "\n") + 1
+}
@@ -0,0 +1,195 @@
+package env
+
+// 配置校验。配置解析后、调用Initializer之前，按配置结构体字段的validate标签检查配置项，
+// 所有不合法的配置项汇总为一个错误返回。多个规则以逗号分隔：
+//   type FooConfig struct {
+//      Bind    string        `validate:"required,hostport"`
+//      Mode    string        `validate:"oneof=dev test prod"`
+//      Workers int           `validate:"min=1,max=64"`
+//      Timeout time.Duration `validate:"min=1s"`
+//      Url     string        `validate:"url"`
+//      CrtFile string        `validate:"file_exists"`
+//   }
+// 规则说明：
+//   required     不能为零值（空字符串、空slice/map等）
+//   min/max      数值比较大小；字符串、slice、map比较长度；time.Duration可写为1s
+//   oneof        取值必须是以空格分隔的值之一
+//   url          带scheme和host的URL
+//   hostport     host:port格式，host可为空，如":8787"
+//   file_exists  替换${...}路径变量后文件必须存在
+// 除required、min、max外，值为空时不检查。
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配置校验错误，每一项为 section.Field: 原因
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// 校验一组配置变量，replace用于替换路径变量
+func validateSections(sections map[string]interface{}, replace func(string) string) error {
+	var errs ValidationErrors
+	for _, name := range sortedKeys(sections) {
+		v := reflect.ValueOf(sections[name])
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		errs = validateStruct(v.Elem(), name, replace, errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateStruct(v reflect.Value, keyPath string, replace func(string) string, errs ValidationErrors) ValidationErrors {
+	rt := v.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		key := keyPath + "." + f.Name
+		tag := f.Tag.Get("validate")
+		if tag != "" && tag != "-" {
+			for _, rule := range strings.Split(tag, ",") {
+				if err := checkRule(fv, strings.TrimSpace(rule), replace); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+				}
+			}
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != typeOfTime {
+			errs = validateStruct(fv, key, replace, errs)
+		}
+	}
+	return errs
+}
+
+func checkRule(v reflect.Value, rule string, replace func(string) string) error {
+	name, param := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, param = rule[:i], rule[i+1:]
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch name {
+	case "":
+		return nil
+	case "required":
+		if isZero(v) {
+			return fmt.Errorf("required")
+		}
+		return nil
+	case "min", "max":
+		return checkRange(v, name, param)
+	}
+
+	if isZero(v) {
+		return nil
+	}
+	s := fmt.Sprint(v.Interface())
+	switch name {
+	case "oneof":
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s], got %q", param, s)
+	case "url":
+		u, err := url.Parse(replace(s))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid url %q", s)
+		}
+	case "hostport":
+		_, port, err := net.SplitHostPort(replace(s))
+		if err != nil {
+			return fmt.Errorf("invalid host:port %q", s)
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid port in %q", s)
+		}
+	case "file_exists":
+		filename := replace(s)
+		if _, err := os.Stat(filename); err != nil {
+			return fmt.Errorf("file %q not exists", filename)
+		}
+	default:
+		return fmt.Errorf("unknown validate rule %q", name)
+	}
+	return nil
+}
+
+func checkRange(v reflect.Value, name, param string) error {
+	if v.Kind() == reflect.Ptr { //nil指针不检查范围
+		return nil
+	}
+	var value, limit float64
+	var err error
+	switch {
+	case v.Type() == typeOfDuration:
+		var d time.Duration
+		d, err = time.ParseDuration(param)
+		value, limit = float64(v.Int()), float64(d)
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		value = float64(v.Len())
+		limit, err = strconv.ParseFloat(param, 64)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		value = float64(v.Int())
+		limit, err = strconv.ParseFloat(param, 64)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		value = float64(v.Uint())
+		limit, err = strconv.ParseFloat(param, 64)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		value = v.Float()
+		limit, err = strconv.ParseFloat(param, 64)
+	default:
+		return fmt.Errorf("%s not supported for %s", name, v.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s=%s", name, param)
+	}
+	if name == "min" && value < limit {
+		return fmt.Errorf("must be >= %s, got %v", param, v.Interface())
+	}
+	if name == "max" && value > limit {
+		return fmt.Errorf("must be <= %s, got %v", param, v.Interface())
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
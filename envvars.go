@@ -0,0 +1,125 @@
+package env
+
+// 路径变量。除内置的${BASE_PATH}、${CONFIG_PATH}、${LOG_PATH}、${VAR_PATH}、${ETH0_IP}、
+// ${ETH1_IP}、${SERVER_NAME}、${CONFIG_NAME}和本机地址变量（见envaddr.go）外，服务可注册自己的变量，
+// 变量值中可以引用内置变量，同名时覆盖内置变量：
+//   env.RegisterVar("DATA_DIR", "${VAR_PATH}/data")
+// 缺省只在调用PathReplace时替换。设置ExpandVars = true后，每次载入配置时
+// 展开所有注册的配置变量中的字符串，包括嵌套结构体、slice和map中的字符串：
+//   func main() {
+//       env.ExpandVars = true
+//       env.InitEnv("xxx_svr")
+//   }
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ExpandVars bool // 载入配置后展开所有字符串配置项中的${...}变量
+
+// 注册一个路径变量，name不带${}，如"DATA_DIR"
+func RegisterVar(name, value string) {
+	defaultEnv.RegisterVar(name, value)
+}
+
+func (e *Env) RegisterVar(name, value string) {
+	e.varsLock.Lock()
+	defer e.varsLock.Unlock()
+	if _, ok := e.customVars[name]; !ok {
+		e.customVarNames = append(e.customVarNames, name)
+	}
+	e.customVars[name] = value
+	if e.builtinVars != nil { //已初始化时立即生效
+		e.buildPathReplacer()
+	}
+}
+
+// 设置内置变量并重新生成PathReplacer
+func (e *Env) setPathVars(oldnew ...string) {
+	e.varsLock.Lock()
+	defer e.varsLock.Unlock()
+	e.builtinVars = oldnew
+	e.buildPathReplacer()
+}
+
+func (e *Env) buildPathReplacer() {
+	builtin := strings.NewReplacer(e.builtinVars...)
+	var oldnew []string
+	for _, name := range e.customVarNames { //自定义变量在前，同名时优先
+		oldnew = append(oldnew, "${"+name+"}", builtin.Replace(e.customVars[name]))
+	}
+	e.PathReplacer = strings.NewReplacer(append(oldnew, e.builtinVars...)...)
+	if e.isDefault {
+		PathReplacer = e.PathReplacer
+	}
+}
+
+// 展开一组配置变量中所有字符串的${...}变量
+func (e *Env) expandSections(sections map[string]interface{}) {
+	for _, name := range sortedKeys(sections) {
+		walkStrings(reflect.ValueOf(sections[name]), name, func(key, s string) (string, error) {
+			return e.PathReplace(s), nil
+		})
+	}
+}
+
+// 遍历配置变量中的所有字符串（包括嵌套结构体、slice和map中的字符串），以fun的返回值替换。
+// key为字符串所在配置项，如 http.Servers[0].Host
+func walkStrings(v reflect.Value, key string, fun func(key, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return walkStrings(v.Elem(), key, fun)
+		}
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+		e := reflect.New(v.Elem().Type()).Elem() //interface中的值不可修改，处理副本后替换
+		e.Set(v.Elem())
+		if err := walkStrings(e, key, fun); err != nil {
+			return err
+		}
+		v.Set(e)
+	case reflect.Struct:
+		if v.Type() == typeOfTime {
+			return nil
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if err := walkStrings(v.Field(i), key+"."+f.Name, fun); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", key, i), fun); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem() //map的值不可寻址，处理副本后写回
+			e.Set(v.MapIndex(k))
+			if err := walkStrings(e, fmt.Sprintf("%s.%v", key, k.Interface()), fun); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, e)
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		s, err := fun(key, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	}
+	return nil
+}
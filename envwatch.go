@@ -0,0 +1,115 @@
+package env
+
+// 配置变化订阅。重新加载配置后（本地配置文件变化、注册中心配置变化或调用Reload），
+// 对内容确实发生变化（深度比较）的section调用Watch注册的回调：
+//   env.Watch("http", func(old, new interface{}) {
+//       o, n := old.(*httpConfigType), new.(*httpConfigType)
+//       ...
+//   })
+// old、new是与注册的配置变量同类型的副本，修改它们不影响当前配置。
+// 所有回调在同一个goroutine中按发生顺序依次调用，不阻塞重新加载；回调中的panic会被恢复并记录日志。
+
+import (
+	"reflect"
+)
+
+// 配置变化回调，old、new为变化前后的配置副本
+type WatchFunc func(old, new interface{})
+
+// 一次待调用的回调
+type watchEvent struct {
+	section  string
+	fun      WatchFunc
+	old, new interface{}
+}
+
+// 订阅一个section的配置变化
+func Watch(section string, fun WatchFunc) {
+	defaultEnv.Watch(section, fun)
+}
+
+func (e *Env) Watch(section string, fun WatchFunc) {
+	e.watchLock.Lock()
+	defer e.watchLock.Unlock()
+	e.watchers[section] = append(e.watchers[section], fun)
+}
+
+// 复制有订阅的section的当前配置，用于重新加载后比较
+func (e *Env) watchedSnapshot() map[string]reflect.Value {
+	e.watchLock.Lock()
+	names := make([]string, 0, len(e.watchers))
+	for name := range e.watchers {
+		names = append(names, name)
+	}
+	e.watchLock.Unlock()
+
+	e.configLock.RLock()
+	defer e.configLock.RUnlock()
+	snapshot := make(map[string]reflect.Value)
+	for _, name := range names {
+		v := reflect.ValueOf(e.tomlConfigMaps[name])
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			continue
+		}
+		snapshot[name] = deepCopy(v)
+	}
+	return snapshot
+}
+
+// 比较重新加载前后的配置，为变化的section排队调用回调
+func (e *Env) notifyWatchers(snapshot map[string]reflect.Value) {
+	e.configLock.RLock()
+	var events []watchEvent
+	for _, name := range sortedKeys(e.tomlConfigMaps) {
+		old, ok := snapshot[name]
+		if !ok {
+			continue
+		}
+		current := deepCopy(reflect.ValueOf(e.tomlConfigMaps[name]))
+		if reflect.DeepEqual(old.Elem().Interface(), current.Elem().Interface()) {
+			continue
+		}
+		e.watchLock.Lock()
+		for _, fun := range e.watchers[name] {
+			events = append(events, watchEvent{name, fun, deepCopy(old).Interface(), deepCopy(current).Interface()})
+		}
+		e.watchLock.Unlock()
+	}
+	e.configLock.RUnlock()
+	if len(events) == 0 {
+		return
+	}
+
+	e.watchLock.Lock()
+	defer e.watchLock.Unlock()
+	e.watchQueue = append(e.watchQueue, events...)
+	if !e.watchRunning { //同一时间只有一个goroutine调用回调
+		e.watchRunning = true
+		go e.runWatchers()
+	}
+}
+
+func (e *Env) runWatchers() {
+	for {
+		e.watchLock.Lock()
+		if len(e.watchQueue) == 0 {
+			e.watchRunning = false
+			e.watchLock.Unlock()
+			return
+		}
+		ev := e.watchQueue[0]
+		e.watchQueue = e.watchQueue[1:]
+		e.watchLock.Unlock()
+
+		callWatch(ev)
+	}
+}
+
+func callWatch(ev watchEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			logEnv.Errorf("watch|%s|panic|%v", ev.section, r)
+		}
+	}()
+	ev.fun(ev.old, ev.new)
+}
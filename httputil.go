@@ -19,12 +19,12 @@ import (
 )
 
 type httpConfigType struct {
-	BaseUrl     string   `desc:"基准url"`  //HOST
+	BaseUrl     string   `desc:"基准url" validate:"required,url"`  //HOST
 	ApiBase     string   `desc:"API前缀"`  //
-	Bind        string   `desc:"监听地址"`
+	Bind        string   `desc:"监听地址" validate:"required,hostport"`
 	Https       bool     `desc:"是否启用https"`
 	CrtFile     string   `desc:"https certificate file"`
-	KeyFile     string   `desc:"https private key file"`
+	KeyFile     string   `desc:"https private key file" secret:"true"`
 	StaticMaps  []string `desc:"静态目录映射"`
 	StaticAuths []string `desc:"static auth list"`
 }
@@ -47,7 +47,7 @@ var (
 )
 
 func init() {
-	env.Register("http", httpConfig)
+	env.Register("http", httpConfig, env.DependsOn("log"))
 }
 
 func (this *httpConfigType) Init() error {
@@ -79,10 +79,19 @@ func (this *httpConfigType) Init() error {
 	// http.HandleFunc(path.Join(HttpPathPrefix, "debug/vars"), expvarHandler)
 
 	Router.HandleFunc(httpConfig.ApiBase+"/debug/vars", expvarHandler)
+	Router.HandleFunc(httpConfig.ApiBase+"/debug/config", configHandler)
 
 	return nil
 }
 
+// 配置重新载入后生效。StaticAuths在每次请求时加读锁读取，会自动生效；
+// 路由前缀、监听地址和证书等需要重启服务才能生效。
+func (this *httpConfigType) Reload() error {
+	BaseUrl = this.BaseUrl
+	logUtil.Info("http config reloaded, Bind/Https/CrtFile/KeyFile/ApiBase take effect after restart")
+	return nil
+}
+
 func HandleStatic(urlPrefix, relPath string) {  //API 处理静态文件函数
 	absPath := relPath
 	if !strings.HasPrefix(relPath, "/") {  //若为相对路径
@@ -129,7 +138,10 @@ func fixXUACompatible(w http.ResponseWriter, r *http.Request) {
 func staticAUTHFilter(h http.Handler) http.Handler {  //静态文件鉴权过滤Handler
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		match := false
-		for _, pa := range httpConfig.StaticAuths {
+		env.RLock() //重新加载时会整体替换配置变量
+		staticAuths := httpConfig.StaticAuths
+		env.RUnlock()
+		for _, pa := range staticAuths {
 			completePath := path.Join(HttpPathPrefix, pa)
 			// path join总是返回clean path，即没有最后一个'/'
 			// 但是mc的path带有（静态文件不需要，如"/index.html"）
@@ -207,6 +219,27 @@ func expvarHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "\n}\n")
 }
 
+// 查询当前配置，敏感配置项已脱敏。
+//   GET ApiBase/debug/config?key=http.Bind   返回单个配置项，key可以是section或中间的结构体
+//   GET ApiBase/debug/config                 返回所有叶子配置项 key -> value
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.FormValue("key")
+	if key == "" {
+		values := make(map[string]interface{})
+		for _, k := range env.Keys() {
+			values[k], _ = env.GetMasked(k)
+		}
+		WriteJson(w, r, values)
+		return
+	}
+	value, ok := env.GetMasked(key)
+	if !ok {
+		http.Error(w, "unknown config key "+key, http.StatusNotFound)
+		return
+	}
+	WriteJson(w, r, map[string]interface{}{"key": key, "value": value})
+}
+
 func GetRequestAddress(req *http.Request) string {
 	address := ""
 	forwardedfor := req.Header.Get("X-Forwarded-For")
@@ -248,14 +281,23 @@ func Listen(accessLog bool) error {
 	//handler = http.DefaultServeMux
 	handler = Router
 
+	// 退出时停止接收新连接，等待处理中的请求完成
+	server := &http.Server{Addr: bindAddr, Handler: handler}
+	env.RegisterStopFunc("http server", server.Shutdown)
+
+	var err error
 	if httpConfig.Https {
 		crtFile := env.PathReplace(httpConfig.CrtFile)
 		keyFile := env.PathReplace(httpConfig.KeyFile)
 		logUtil.Info("Start Normal HTTPS at ", bindAddr)
-		return http.ListenAndServeTLS(bindAddr, crtFile, keyFile, handler)
+		err = server.ListenAndServeTLS(crtFile, keyFile)
 	} else {
 		logUtil.Info("Start Normal HTTP at ", bindAddr)
-		return http.ListenAndServe(bindAddr, handler)
+		err = server.ListenAndServe()
 	}
-	return nil
+	if err == http.ErrServerClosed { //Shutdown已开始，等待所有组件停止后返回
+		env.WaitShutdown()
+		return nil
+	}
+	return err
 }
@@ -18,6 +18,7 @@ type config struct {
 	FilePath string
 	Debug    bool
 	*os.File
+	closed bool // 已关闭，之后的日志输出到终端
 }
 
 var currentFile *os.File
@@ -88,7 +89,13 @@ func (logger *Logger) commonLogf(logType string, format string, v ...interface{}
 func Init(logFilePath string, debug bool) {
 	Config.FilePath = logFilePath
 	Config.Debug = debug
-	Config.File = nil
+	oldFile := Config.File
+	Config.File = nil //下次写日志时按新配置打开
+	Config.closed = false
+	if oldFile != nil {
+		log.SetOutput(os.Stderr)
+		closeFile(oldFile)
+	}
 	log.SetFlags(log.Ldate | log.Ltime)
 	return
 }
@@ -138,6 +145,9 @@ func writeLog(logStr string) (err error) {
 }
 
 func resetOutputIfNeed() (err error) {
+	if Config.closed {
+		return
+	}
 	needReset := false
 	logFilePath := getLogFilePath()
 	if Config.File == nil {
@@ -169,6 +179,19 @@ func resetOutputIfNeed() (err error) {
 	return
 }
 
+// 关闭日志文件，之后的日志输出到终端。退出时调用
+func Close() error {
+	Config.closed = true
+	log.SetOutput(os.Stderr)
+	file := Config.File
+	Config.File = nil
+	if file == nil {
+		return nil
+	}
+	file.Sync()
+	return file.Close()
+}
+
 func closeFile(file *os.File) {
 	if file == nil {
 		return
@@ -0,0 +1,486 @@
+// 配置注册中心。按 服务名/配置名(dev/prod...)/section 管理配置文档，
+// 以JSON文件保存在本地目录，无需外部存储服务。
+// 每次修改生成一个版本号递增、不可修改的历史版本，可查看差异并回滚。
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配置文档。一个服务的一套配置，如 xxx_svr 的 prod 配置
+type Document struct {
+	Server   string                            `json:"server"`
+	Config   string                            `json:"config"`
+	Version  int64                             `json:"version"` // 每次修改加1
+	Sections map[string]map[string]interface{} `json:"sections"`
+	Created  time.Time                         `json:"created"`
+	Updated  time.Time                         `json:"updated"`
+	Author   string                            `json:"author"`  // 本版本的修改人
+	Comment  string                            `json:"comment"` // 本版本的修改说明
+}
+
+// 历史版本摘要
+type RevisionInfo struct {
+	Version int64     `json:"version"`
+	Author  string    `json:"author"`
+	Comment string    `json:"comment"`
+	Time    time.Time `json:"time"`
+}
+
+// 两个版本间一个section的差异
+type SectionDiff struct {
+	Section string                 `json:"section"`
+	Status  string                 `json:"status"` // added/removed/changed
+	Keys    []string               `json:"keys"`   // 新增、删除或修改的配置项
+	Old     map[string]interface{} `json:"old,omitempty"`
+	New     map[string]interface{} `json:"new,omitempty"`
+}
+
+const (
+	DIFF_ADDED   = "added"
+	DIFF_REMOVED = "removed"
+	DIFF_CHANGED = "changed"
+)
+
+// 配置文档摘要，用于列表
+type Summary struct {
+	Server   string    `json:"server"`
+	Config   string    `json:"config"`
+	Version  int64     `json:"version"`
+	Sections []string  `json:"sections"`
+	Updated  time.Time `json:"updated"`
+}
+
+var (
+	ErrNotFound = fmt.Errorf("config not found")
+	ErrExists   = fmt.Errorf("config already exists")
+
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_\-\.]+$`)
+)
+
+func checkName(kind, name string) error {
+	if !nameRe.MatchString(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// 本地配置存储。每个配置文档保存为 <dir>/<server>/<config>.json，
+// 历史版本保存为 <dir>/<server>/<config>.history/<version>.json
+type Store struct {
+	dir     string
+	lock    sync.RWMutex
+	docs    map[string]*Document // server/config -> 配置文档
+	changed chan struct{}        // 任一配置文档变化时关闭并替换，通知等待者
+}
+
+func docKey(server, config string) string {
+	return server + "/" + config
+}
+
+// 打开配置存储，载入目录中已有的配置文档
+func NewStore(dir string) (store *Store, err error) {
+	store = &Store{dir: dir, docs: make(map[string]*Document), changed: make(chan struct{})}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		if !server.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(path.Join(dir, server.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || path.Ext(file.Name()) != ".json" {
+				continue
+			}
+			doc, err := readDocument(path.Join(dir, server.Name(), file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			store.docs[docKey(doc.Server, doc.Config)] = doc
+		}
+	}
+	return
+}
+
+func readDocument(filename string) (*Document, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	err = json.Unmarshal(data, doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return doc, nil
+}
+
+func (s *Store) historyDir(server, config string) string {
+	return path.Join(s.dir, server, config+".history")
+}
+
+func (s *Store) revisionFile(server, config string, version int64) string {
+	return path.Join(s.historyDir(server, config), fmt.Sprintf("%d.json", version))
+}
+
+// 写入配置文档及其历史版本。历史版本已存在时报错，不覆盖；
+// 配置文档先写临时文件再改名，避免写到一半的文件。
+// 任一步失败时删除已写的历史版本，否则以后的修改会因版本号冲突而一直失败
+func (s *Store) save(doc *Document) error {
+	dir := path.Join(s.dir, doc.Server)
+	err := os.MkdirAll(s.historyDir(doc.Server, doc.Config), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	revisionFile := s.revisionFile(doc.Server, doc.Config, doc.Version)
+	revision, err := os.OpenFile(revisionFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return err
+	}
+	_, err = revision.Write(data)
+	if e := revision.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = writeFileAtomic(path.Join(dir, doc.Config+".json"), data)
+	}
+	if err != nil {
+		os.Remove(revisionFile)
+		return err
+	}
+	return nil
+}
+
+// 先写临时文件再改名
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0644)
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// 复制配置文档，避免调用者修改存储中的数据
+func (doc *Document) clone() *Document {
+	c := *doc
+	c.Sections = make(map[string]map[string]interface{}, len(doc.Sections))
+	for name, section := range doc.Sections {
+		c.Sections[name] = section
+	}
+	return &c
+}
+
+func (doc *Document) summary() *Summary {
+	sum := &Summary{
+		Server:  doc.Server,
+		Config:  doc.Config,
+		Version: doc.Version,
+		Updated: doc.Updated,
+	}
+	for name := range doc.Sections {
+		sum.Sections = append(sum.Sections, name)
+	}
+	sort.Strings(sum.Sections)
+	return sum
+}
+
+// 列出配置文档，server为空时列出所有服务的配置
+func (s *Store) List(server string) []*Summary {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := []*Summary{}
+	for _, doc := range s.docs {
+		if server == "" || doc.Server == server {
+			ret = append(ret, doc.summary())
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return docKey(ret[i].Server, ret[i].Config) < docKey(ret[j].Server, ret[j].Config)
+	})
+	return ret
+}
+
+// 读取配置文档
+func (s *Store) Get(server, config string) (*Document, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	doc, ok := s.docs[docKey(server, config)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.clone(), nil
+}
+
+// 创建配置文档
+func (s *Store) Create(server, config string, sections map[string]map[string]interface{}, author, comment string) (*Document, error) {
+	if err := checkName("server", server); err != nil {
+		return nil, err
+	}
+	if err := checkName("config", config); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := docKey(server, config)
+	if _, ok := s.docs[key]; ok {
+		return nil, ErrExists
+	}
+	now := time.Now()
+	doc := &Document{
+		Server:   server,
+		Config:   config,
+		Version:  1,
+		Sections: make(map[string]map[string]interface{}),
+		Created:  now,
+		Updated:  now,
+		Author:   author,
+		Comment:  comment,
+	}
+	for name, section := range sections {
+		if section != nil { //与Update一致，null表示没有该section
+			doc.Sections[name] = section
+		}
+	}
+	err := s.save(doc)
+	if err != nil {
+		return nil, err
+	}
+	s.docs[key] = doc
+	s.notify()
+	return doc.clone(), nil
+}
+
+// 修改配置文档。sections中的section整体替换原有section，值为null的section被删除
+func (s *Store) Update(server, config string, sections map[string]map[string]interface{}, author, comment string) (*Document, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old, ok := s.docs[docKey(server, config)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	doc := old.clone()
+	for name, section := range sections {
+		if section == nil {
+			delete(doc.Sections, name)
+		} else {
+			doc.Sections[name] = section
+		}
+	}
+	return s.commit(doc, author, comment)
+}
+
+// 以doc的内容生成新版本，调用时须持有写锁
+func (s *Store) commit(doc *Document, author, comment string) (*Document, error) {
+	doc.Version = s.docs[docKey(doc.Server, doc.Config)].Version + 1
+	doc.Updated = time.Now()
+	doc.Author = author
+	doc.Comment = comment
+	err := s.save(doc)
+	if err != nil {
+		return nil, err
+	}
+	s.docs[docKey(doc.Server, doc.Config)] = doc
+	s.notify()
+	return doc.clone(), nil
+}
+
+// 通知所有等待者配置已变化，调用时须持有写锁
+func (s *Store) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// 等待配置文档的版本与version不同，返回新的配置文档。超时返回false
+func (s *Store) Wait(server, config string, version int64, timeout time.Duration) (*Document, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.lock.RLock()
+		doc, ok := s.docs[docKey(server, config)]
+		changed := s.changed
+		s.lock.RUnlock()
+		if ok && doc.Version != version {
+			return doc.clone(), true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, false
+		}
+	}
+}
+
+// 检查名字合法且配置文档存在，避免以请求参数访问数据目录以外的文件
+func (s *Store) checkDoc(server, config string) error {
+	if err := checkName("server", server); err != nil {
+		return err
+	}
+	if err := checkName("config", config); err != nil {
+		return err
+	}
+	s.lock.RLock()
+	_, ok := s.docs[docKey(server, config)]
+	s.lock.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// 列出配置文档的历史版本，按版本号从新到旧排列
+func (s *Store) Revisions(server, config string) ([]*RevisionInfo, error) {
+	if err := s.checkDoc(server, config); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(s.historyDir(server, config))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ret := []*RevisionInfo{}
+	for _, file := range files {
+		if file.IsDir() || path.Ext(file.Name()) != ".json" {
+			continue
+		}
+		doc, err := readDocument(path.Join(s.historyDir(server, config), file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &RevisionInfo{
+			Version: doc.Version,
+			Author:  doc.Author,
+			Comment: doc.Comment,
+			Time:    doc.Updated,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version > ret[j].Version
+	})
+	return ret, nil
+}
+
+// 读取一个历史版本
+func (s *Store) Revision(server, config string, version int64) (*Document, error) {
+	if err := s.checkDoc(server, config); err != nil {
+		return nil, err
+	}
+	return s.readRevision(server, config, version)
+}
+
+// 读取历史版本文件，调用前须确认配置文档存在
+func (s *Store) readRevision(server, config string, version int64) (*Document, error) {
+	doc, err := readDocument(s.revisionFile(server, config, version))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return doc, err
+}
+
+// 比较两个历史版本，返回有差异的section
+func (s *Store) Diff(server, config string, from, to int64) ([]*SectionDiff, error) {
+	old, err := s.Revision(server, config, from)
+	if err != nil {
+		return nil, err
+	}
+	new, err := s.Revision(server, config, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffSections(old.Sections, new.Sections), nil
+}
+
+func diffSections(old, new map[string]map[string]interface{}) []*SectionDiff {
+	ret := []*SectionDiff{}
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+	for name := range names {
+		o, inOld := old[name]
+		n, inNew := new[name]
+		diff := &SectionDiff{Section: name, Old: o, New: n}
+		switch {
+		case !inOld:
+			diff.Status = DIFF_ADDED
+		case !inNew:
+			diff.Status = DIFF_REMOVED
+		default:
+			diff.Status = DIFF_CHANGED
+		}
+		diff.Keys = diffKeys(o, n)
+		if len(diff.Keys) == 0 && inOld && inNew {
+			continue
+		}
+		ret = append(ret, diff)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Section < ret[j].Section
+	})
+	return ret
+}
+
+func diffKeys(old, new map[string]interface{}) []string {
+	keys := []string{}
+	for k, v := range old {
+		if v0, ok := new[k]; !ok || !reflect.DeepEqual(v, v0) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 回滚到一个历史版本。回滚生成一个新版本，与普通修改一样通知等待者
+func (s *Store) Rollback(server, config string, version int64, author, comment string) (*Document, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cur, ok := s.docs[docKey(server, config)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	revision, err := s.readRevision(server, config, version) //已持有写锁，不能再调用Revision
+	if err != nil {
+		return nil, err
+	}
+	doc := cur.clone()
+	doc.Sections = revision.clone().Sections
+	if comment == "" {
+		comment = fmt.Sprintf("rollback to version %d", version)
+	}
+	return s.commit(doc, author, comment)
+}
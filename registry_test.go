@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestStoreRevisions(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	v1 := map[string]map[string]interface{}{
+		"http": {"Bind": ":8787"},
+		"db":   {"Host": "db1"},
+	}
+	doc, err := store.Create("xxx_svr", "prod", v1, "alice", "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 1 {
+		t.Fatalf("created version %d", doc.Version)
+	}
+	if _, err := store.Create("xxx_svr", "prod", v1, "alice", ""); err != ErrExists {
+		t.Fatalf("create twice: %v", err)
+	}
+
+	doc, err = store.Update("xxx_svr", "prod", map[string]map[string]interface{}{
+		"http": {"Bind": ":8788"},
+		"db":   nil,
+	}, "bob", "move port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 || doc.Sections["http"]["Bind"] != ":8788" || doc.Sections["db"] != nil {
+		t.Fatalf("updated: %+v", doc)
+	}
+
+	revisions, err := store.Revisions("xxx_svr", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[0].Author != "bob" {
+		t.Fatalf("revisions: %+v", revisions)
+	}
+
+	diffs, err := store.Diff("xxx_svr", "prod", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 ||
+		diffs[0].Section != "db" || diffs[0].Status != DIFF_REMOVED ||
+		diffs[1].Section != "http" || diffs[1].Status != DIFF_CHANGED || !reflect.DeepEqual(diffs[1].Keys, []string{"Bind"}) {
+		t.Fatalf("diff: %+v %+v", diffs[0], diffs[1])
+	}
+
+	doc, err = store.Rollback("xxx_svr", "prod", 1, "carol", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 3 || !reflect.DeepEqual(doc.Sections, v1) || doc.Comment != "rollback to version 1" {
+		t.Fatalf("rollback: %+v", doc)
+	}
+	if _, err := store.Rollback("xxx_svr", "prod", 9, "carol", ""); err != ErrNotFound {
+		t.Fatalf("rollback to missing version: %v", err)
+	}
+
+	// 重新打开后读到最新版本
+	reopened, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := reopened.Get("xxx_svr", "prod"); err != nil || doc.Version != 3 {
+		t.Fatalf("reopened: %+v, %v", doc, err)
+	}
+}
+
+// 名字中不能有路径，避免读取数据目录以外的文件
+func TestStoreNames(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	if _, err := store.Create("xxx_svr", "prod", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		server, config string
+	}{
+		{"..", "prod"},
+		{"xxx_svr", "../prod"},
+		{"xxx_svr", "..%2fprod"},
+		{"../xxx_svr", "prod"},
+		{"xxx_svr/x", "prod"},
+		{"", "prod"},
+		{".hidden", "prod"},
+	}
+	for _, test := range tests {
+		if _, err := store.Create(test.server, test.config, nil, "", ""); err == nil {
+			t.Errorf("Create(%q, %q) accepted", test.server, test.config)
+		}
+		if _, err := store.Revisions(test.server, test.config); err == nil {
+			t.Errorf("Revisions(%q, %q) accepted", test.server, test.config)
+		}
+		if _, err := store.Revision(test.server, test.config, 1); err == nil {
+			t.Errorf("Revision(%q, %q) accepted", test.server, test.config)
+		}
+		if _, err := store.Diff(test.server, test.config, 1, 1); err == nil {
+			t.Errorf("Diff(%q, %q) accepted", test.server, test.config)
+		}
+	}
+	if _, err := store.Revisions("other_svr", "prod"); err != ErrNotFound {
+		t.Errorf("Revisions of missing document: %v", err)
+	}
+}
+
+// 写配置文档失败时不留下历史版本，修复后可以继续修改
+func TestStoreSaveFailure(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	if _, err := store.Create("xxx_svr", "prod", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	blocker := path.Join(dir, "xxx_svr", "prod.json.tmp") //临时文件路径被目录占用，写入失败
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	update := map[string]map[string]interface{}{"http": {"Bind": ":8788"}}
+	if _, err := store.Update("xxx_svr", "prod", update, "", ""); err == nil {
+		t.Fatal("update succeeded with unwritable document")
+	}
+	if _, err := os.Stat(store.revisionFile("xxx_svr", "prod", 2)); !os.IsNotExist(err) {
+		t.Fatalf("revision 2 left on disk: %v", err)
+	}
+
+	os.Remove(blocker)
+	doc, err := store.Update("xxx_svr", "prod", update, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 {
+		t.Fatalf("version %d after retry", doc.Version)
+	}
+}
+
+func TestStoreWait(t *testing.T) {
+	store, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	if _, err := store.Create("xxx_svr", "prod", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Wait("xxx_svr", "prod", 1, 50*time.Millisecond); ok {
+		t.Fatal("wait returned without change")
+	}
+	if doc, ok := store.Wait("xxx_svr", "prod", 0, time.Second); !ok || doc.Version != 1 {
+		t.Fatalf("wait with old version: %+v, %v", doc, ok)
+	}
+
+	done := make(chan *Document)
+	go func() {
+		doc, _ := store.Wait("xxx_svr", "prod", 1, 5*time.Second)
+		done <- doc
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := store.Update("xxx_svr", "prod", map[string]map[string]interface{}{"http": {"Bind": ":1"}}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case doc := <-done:
+		if doc == nil || doc.Version != 2 {
+			t.Fatalf("woken with %+v", doc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait not woken by update")
+	}
+}
@@ -0,0 +1,293 @@
+package registry
+
+import (
+	"net/http"
+	"time"
+
+	"../acl"
+	"../env"
+	"../errutil"
+	"../ext"
+	"../httputil"
+	"../log"
+)
+
+// 注册中心配置
+type registryConfigType struct {
+	DataPath string `desc:"配置文档存储目录" validate:"required"`
+}
+
+var (
+	logRegistry    = log.NewLogger("registry")
+	registryConfig = &registryConfigType{
+		DataPath: "${VAR_PATH}/registry",
+	}
+
+	store *Store
+)
+
+func init() {
+	env.Register("registry", registryConfig, env.DependsOn("log"))
+}
+
+func (this *registryConfigType) Init() (err error) {
+	dataPath := env.PathReplace(this.DataPath)
+	store, err = NewStore(dataPath)
+	if err != nil {
+		return
+	}
+	logRegistry.Info("registry data path is ", dataPath)
+	return
+}
+
+const (
+	ERR_PARAM     = 1001 // 参数错误
+	ERR_NOT_FOUND = 1002 // 配置不存在
+	ERR_EXISTS    = 1003 // 配置已存在
+	ERR_STORE     = 1004 // 存储错误
+)
+
+func apiError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case ErrNotFound:
+		return errutil.NewAPIError(ERR_NOT_FOUND, err.Error(), nil)
+	case ErrExists:
+		return errutil.NewAPIError(ERR_EXISTS, err.Error(), nil)
+	}
+	logRegistry.Error(err)
+	return errutil.NewAPIError(ERR_STORE, err.Error(), nil)
+}
+
+func paramError(msg string) error {
+	return errutil.NewAPIError(ERR_PARAM, msg, nil)
+}
+
+type ListParams struct {
+	Server string `schema:"server"`
+}
+
+// 列出配置文档
+func listConfig(params *ListParams) ([]*Summary, error) {
+	return store.List(params.Server), nil
+}
+
+type GetParams struct {
+	Server  string `schema:"server"`
+	Config  string `schema:"config"`
+	Section string `schema:"section"` // 为空时返回整个配置文档
+}
+
+// 读取配置文档或其中一个section
+func getConfig(params *GetParams) (interface{}, error) {
+	if params.Server == "" || params.Config == "" {
+		return nil, paramError("server and config are required")
+	}
+	doc, err := store.Get(params.Server, params.Config)
+	if err != nil {
+		return nil, apiError(err)
+	}
+	if params.Section == "" {
+		return doc, nil
+	}
+	section, ok := doc.Sections[params.Section]
+	if !ok {
+		return nil, apiError(ErrNotFound)
+	}
+	return section, nil
+}
+
+type UpdateParams struct {
+	Server   string                            `json:"server"`
+	Config   string                            `json:"config"`
+	Sections map[string]map[string]interface{} `json:"sections"`
+	Section  string                            `json:"section"` // 只修改一个section时使用
+	Data     map[string]interface{}            `json:"data"`
+	Delete   bool                              `json:"delete"`  // 删除section，只用于修改
+	Comment  string                            `json:"comment"` // 修改说明
+}
+
+// 当前登录用户，作为历史版本的修改人
+func getAuthor(req *http.Request) string {
+	ui := acl.GetUserInfo(req)
+	if ui == nil {
+		return ""
+	}
+	return ui.LoginName
+}
+
+func (params *UpdateParams) check() error {
+	if params.Server == "" || params.Config == "" {
+		return paramError("server and config are required")
+	}
+	if params.Section != "" {
+		switch {
+		case params.Delete && params.Data != nil:
+			return paramError("data and delete are exclusive")
+		case !params.Delete && params.Data == nil: //忘记data时不能当作删除
+			return paramError("data is required, set delete to remove the section")
+		}
+		if params.Sections == nil {
+			params.Sections = make(map[string]map[string]interface{})
+		}
+		params.Sections[params.Section] = params.Data //Delete时为nil，Store.Update删除该section
+	} else if params.Delete {
+		return paramError("delete requires section")
+	}
+	return nil
+}
+
+// 创建配置文档
+func createConfig(params *UpdateParams, req *http.Request) (*Document, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	if params.Delete {
+		return nil, paramError("delete is not allowed when creating")
+	}
+	doc, err := store.Create(params.Server, params.Config, params.Sections, getAuthor(req), params.Comment)
+	if err != nil {
+		return nil, apiError(err)
+	}
+	logRegistry.Infof("create|%s/%s|version=%d|author=%s", doc.Server, doc.Config, doc.Version, doc.Author)
+	return doc, nil
+}
+
+// 修改配置文档的section
+func updateConfig(params *UpdateParams, req *http.Request) (*Document, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	if len(params.Sections) == 0 {
+		return nil, paramError("no section to update")
+	}
+	doc, err := store.Update(params.Server, params.Config, params.Sections, getAuthor(req), params.Comment)
+	if err != nil {
+		return nil, apiError(err)
+	}
+	logRegistry.Infof("update|%s/%s|version=%d|author=%s", doc.Server, doc.Config, doc.Version, doc.Author)
+	return doc, nil
+}
+
+type WatchParams struct {
+	Server  string `schema:"server"`
+	Config  string `schema:"config"`
+	Version int64  `schema:"version"` // 客户端当前的配置版本
+	Timeout int    `schema:"timeout"` // 最长等待秒数
+}
+
+type WatchResult struct {
+	Changed  bool      `json:"changed"`
+	Document *Document `json:"document,omitempty"`
+}
+
+const (
+	WATCH_TIMEOUT     = 30  // 缺省等待秒数
+	WATCH_MAX_TIMEOUT = 300 // 最长等待秒数
+)
+
+// 长轮询：配置版本与version不同时立即返回新配置，否则等待配置变化或超时
+func watchConfig(params *WatchParams) (*WatchResult, error) {
+	if params.Server == "" || params.Config == "" {
+		return nil, paramError("server and config are required")
+	}
+	timeout := params.Timeout
+	if timeout <= 0 {
+		timeout = WATCH_TIMEOUT
+	}
+	if timeout > WATCH_MAX_TIMEOUT {
+		timeout = WATCH_MAX_TIMEOUT
+	}
+	doc, ok := store.Wait(params.Server, params.Config, params.Version, time.Duration(timeout)*time.Second)
+	return &WatchResult{Changed: ok, Document: doc}, nil
+}
+
+type RevisionParams struct {
+	Server  string `schema:"server"`
+	Config  string `schema:"config"`
+	Version int64  `schema:"version"` // 为0时列出所有历史版本
+}
+
+// 列出历史版本，或读取指定的历史版本
+func getRevisions(params *RevisionParams) (interface{}, error) {
+	if params.Server == "" || params.Config == "" {
+		return nil, paramError("server and config are required")
+	}
+	if params.Version > 0 {
+		doc, err := store.Revision(params.Server, params.Config, params.Version)
+		return doc, apiError(err)
+	}
+	revisions, err := store.Revisions(params.Server, params.Config)
+	return revisions, apiError(err)
+}
+
+type DiffParams struct {
+	Server string `schema:"server"`
+	Config string `schema:"config"`
+	From   int64  `schema:"from"`
+	To     int64  `schema:"to"` // 为0时与当前版本比较
+}
+
+// 比较两个历史版本
+func diffConfig(params *DiffParams) ([]*SectionDiff, error) {
+	if params.Server == "" || params.Config == "" || params.From <= 0 {
+		return nil, paramError("server, config and from are required")
+	}
+	if params.To <= 0 {
+		doc, err := store.Get(params.Server, params.Config)
+		if err != nil {
+			return nil, apiError(err)
+		}
+		params.To = doc.Version
+	}
+	diffs, err := store.Diff(params.Server, params.Config, params.From, params.To)
+	return diffs, apiError(err)
+}
+
+type RollbackParams struct {
+	Server  string `json:"server"`
+	Config  string `json:"config"`
+	Version int64  `json:"version"` // 回滚到的历史版本
+	Comment string `json:"comment"`
+}
+
+// 回滚到历史版本
+func rollbackConfig(params *RollbackParams, req *http.Request) (*Document, error) {
+	if params.Server == "" || params.Config == "" || params.Version <= 0 {
+		return nil, paramError("server, config and version are required")
+	}
+	doc, err := store.Rollback(params.Server, params.Config, params.Version, getAuthor(req), params.Comment)
+	if err != nil {
+		return nil, apiError(err)
+	}
+	logRegistry.Infof("rollback|%s/%s|to=%d|version=%d|author=%s", doc.Server, doc.Config, params.Version, doc.Version, doc.Author)
+	return doc, nil
+}
+
+// 服务读取配置的接口，以apisign签名鉴权（ext.SignChecker），不需要用户登录。
+// 服务的app和secret需登记在ext的app表中，env按同样的规则签名请求
+func signApify(fun interface{}) http.Handler {
+	return httputil.HandlerChain{
+		ext.SignChecker,
+		httputil.APILOG,
+		httputil.SchemaRPC(fun),
+		httputil.JSON,
+	}
+}
+
+// 注册中心API，挂载方式：
+//   httputil.HandleAPIMap("/registry", registry.APIMap)
+// 除/list只返回摘要外，都会返回配置内容（含敏感配置项），需要鉴权：
+// 服务调用的/get、/watch校验签名，其余供管理使用的接口校验用户登录(acl.APIAUTH)
+var APIMap = httputil.APIMap{
+	"/list":   httputil.SchemaApify(listConfig),
+	"/get":    signApify(getConfig),
+	"/create": httputil.JsonAuthApify(createConfig),
+	"/update": httputil.JsonAuthApify(updateConfig),
+	"/watch":  signApify(watchConfig),
+
+	"/revisions": httputil.SchemaAuthApify(getRevisions),
+	"/diff":      httputil.SchemaAuthApify(diffConfig),
+	"/rollback":  httputil.JsonAuthApify(rollbackConfig),
+}